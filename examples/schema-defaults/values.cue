@@ -0,0 +1,14 @@
+#values: {
+	replicas?: int
+
+	// Regular field with default, filled into test values when omitted, taking
+	// precedence over default of chart's values.yaml
+	logLevel: *"info" | "debug" | "warn"
+
+	// Optional field, left absent when omitted, despite its default
+	region?: *"us-east-1" | string
+
+	storage: {
+		retention: *"7d" | string
+	}
+}
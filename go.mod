@@ -6,10 +6,12 @@ toolchain go1.22.3
 
 require (
 	cuelang.org/go v0.8.2
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/hexops/gotextdiff v1.0.3
 	github.com/spf13/cobra v1.8.0
 	github.com/yannh/kubeconform v0.6.2
-	gopkg.in/yaml.v2 v2.4.0
+	golang.org/x/text v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 	helm.sh/helm/v3 v3.12.0
 )
 
@@ -118,14 +120,13 @@ require (
 	golang.org/x/sync v0.6.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/term v0.18.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/time v0.0.0-20220210224613-90d013bbcef8 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
 	google.golang.org/grpc v1.53.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/inf.v0 v0.9.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 	k8s.io/api v0.27.1 // indirect
 	k8s.io/apiextensions-apiserver v0.27.1 // indirect
 	k8s.io/apimachinery v0.27.2 // indirect
@@ -0,0 +1,76 @@
+package testchart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// assertionsFileName is the name of the optional file, in a test directory, listing
+// assertions on rendered resources, in addition to or instead of an expected file
+const assertionsFileName = "assertions.yaml"
+
+// Assertion specifies the exact number of resources of given kind expected to be
+// rendered (eg: 0 to assert that no such resource is rendered)
+type Assertion struct {
+	Kind  string `yaml:"kind"`
+	Count *int   `yaml:"count"`
+}
+
+// loadAssertions loads the assertions file from given test directory, returning no
+// assertions if it does not exist
+func loadAssertions(testDir string) ([]Assertion, error) {
+	assertionsPath := filepath.Join(testDir, assertionsFileName)
+	data, err := os.ReadFile(assertionsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var assertions []Assertion
+	if err := unmarshalStrict(data, &assertions); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", assertionsPath, err)
+	}
+	for i, assertion := range assertions {
+		if assertion.Kind == "" {
+			return nil, fmt.Errorf("parsing %q: assertion #%d: kind must not be empty", assertionsPath, i+1)
+		}
+		if assertion.Count == nil || *assertion.Count < 0 {
+			return nil, fmt.Errorf("parsing %q: assertion #%d: count must be specified and not negative", assertionsPath, i+1)
+		}
+	}
+	return assertions, nil
+}
+
+// checkAssertions evaluates given assertions against the resources of given manifest
+// and reports failed ones to builder, returning whether they all passed
+func checkAssertions(builder Builder, assertions []Assertion, manifest string) bool {
+	if len(assertions) == 0 {
+		return true
+	}
+
+	counts := make(map[string]int)
+	main, hooks, testHooks := splitSections(manifest)
+	for _, section := range []string{main, hooks, testHooks} {
+		for _, document := range splitDocuments(section) {
+			var header resourceHeader
+			if err := yaml.Unmarshal([]byte(document), &header); err == nil && header.Kind != "" {
+				counts[header.Kind]++
+			}
+		}
+	}
+
+	isSuccessful := true
+	for _, assertion := range assertions {
+		if count := counts[assertion.Kind]; count != *assertion.Count {
+			builder.AddFailedAssertion(fmt.Sprintf("expected %d %s resources, got %d", *assertion.Count, assertion.Kind, count))
+			isSuccessful = false
+		}
+	}
+	return isSuccessful
+}
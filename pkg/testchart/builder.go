@@ -0,0 +1,668 @@
+package testchart
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+)
+
+type Builder interface {
+	StartAllTests(names []string)
+
+	StartTest(name string)
+
+	SetTestComparisonResult(isSame bool)
+	SetTestError(err error)
+	SetRenderedSources(sources []string)
+	SetEmptyRender(isEmpty bool)
+	SetDuration(duration time.Duration)
+	SetIgnoredCount(count int)
+	AddValidationError(signature, error string)
+	AddValidationWarning(signature, error string)
+
+	AddDifferentItem(source, expected, actual string)
+	AddDifferentItemAt(source, path, expected, actual string)
+	AddMissingItem(source, expected string)
+	AddExtraItem(source, actual string)
+	AddAllowedExtraItem(source string)
+	AddSortedList(source, path string)
+	AddFailedAssertion(message string)
+
+	ShowValues(getValuesYaml func() (string, error))
+
+	EndTest() error
+	EndUpdateReview(isAccepted bool)
+
+	EndAllTests()
+	IsSuccessful() bool
+	Results() []TestResult
+}
+
+type Item struct {
+	source, expected, actual string
+
+	// path is the path of first structural difference between expected and actual
+	// content (eg: spec.replicas), only known when comparing structurally
+	path string
+
+	// diff is the unified diff between expected and actual content, computed once
+	// when a different item is added, as it is costly for large manifests
+	diff string
+}
+
+// unifiedDiff returns the uncolored unified diff between expected and actual
+// content of item, reusing the precomputed one if any
+func (item Item) unifiedDiff() string {
+	if item.diff != "" {
+		return item.diff
+	}
+	return unifiedDiff(item.expected, item.actual, DefaultDiffContext)
+}
+
+type ValidationError struct {
+	signature, error string
+}
+
+type SortedList struct {
+	source, path string
+}
+
+// TestResult accumulates the results of a single test, to be embedded by builders
+type TestResult struct {
+	name                                     string
+	isSame, isValid                          bool
+	differentItems, missingItems, extraItems []Item
+	validationErrors, validationWarnings     []ValidationError
+	sortedLists                              []SortedList
+	allowedExtras                            []string
+	failedAssertions                         []string
+	runError                                 error
+	renderedSources                          []string
+	isEmptyRender                            bool
+	getValuesYaml                            func() (string, error)
+	duration                                 time.Duration
+	ignoredCount                             int
+	settings                                 recordSettings
+}
+
+// recordSettings holds the settings of a run affecting how items of its tests are
+// recorded, which builders pass on to the result of each test
+type recordSettings struct {
+	redact      bool
+	diffContext int
+}
+
+// defaultRecordSettings returns the record settings of builders not created for a run
+func defaultRecordSettings() recordSettings {
+	return recordSettings{diffContext: DefaultDiffContext}
+}
+
+func newTestResult(name string, settings recordSettings) TestResult {
+	return TestResult{name: name, isSame: true, isValid: true, settings: settings}
+}
+
+func (tr *TestResult) isSuccessful() bool {
+	return tr.isSame && tr.isValid && tr.runError == nil && len(tr.failedAssertions) == 0
+}
+
+func (tr *TestResult) SetTestComparisonResult(isSame bool) {
+	tr.isSame = isSame
+}
+
+// SetTestError records an error that prevented the test from completing
+func (tr *TestResult) SetTestError(err error) {
+	tr.runError = err
+}
+
+// SetDuration records the wall-clock time taken to run the test
+func (tr *TestResult) SetDuration(duration time.Duration) {
+	tr.duration = duration
+}
+
+// SetIgnoredCount records the number of resources excluded from comparison by kind
+func (tr *TestResult) SetIgnoredCount(count int) {
+	tr.ignoredCount = count
+}
+
+// SetEmptyRender records whether the test rendered no resources to compare
+func (tr *TestResult) SetEmptyRender(isEmpty bool) {
+	tr.isEmptyRender = isEmpty
+}
+
+// SetRenderedSources records the template paths rendered by the test, for coverage
+func (tr *TestResult) SetRenderedSources(sources []string) {
+	tr.renderedSources = sources
+}
+
+func (tr *TestResult) AddValidationError(signature, error string) {
+	tr.validationErrors = append(tr.validationErrors, ValidationError{signature, error})
+	tr.isValid = false
+}
+
+// AddValidationWarning records a validation error that must not fail the test
+func (tr *TestResult) AddValidationWarning(signature, error string) {
+	tr.validationWarnings = append(tr.validationWarnings, ValidationError{signature, error})
+}
+
+func (tr *TestResult) AddDifferentItem(source, expected, actual string) {
+	tr.AddDifferentItemAt(source, "", expected, actual)
+}
+
+// AddDifferentItemAt records a different item, along with the path of its first
+// structural difference, if known
+func (tr *TestResult) AddDifferentItemAt(source, path, expected, actual string) {
+	if tr.settings.redact {
+		expected = redactSecret(expected)
+		actual = redactSecret(actual)
+	}
+	tr.differentItems = append(tr.differentItems, Item{source: source, path: path, expected: expected, actual: actual, diff: unifiedDiff(expected, actual, tr.settings.diffContext)})
+}
+
+func (tr *TestResult) AddMissingItem(source, expected string) {
+	if tr.settings.redact {
+		expected = redactSecret(expected)
+	}
+	tr.missingItems = append(tr.missingItems, Item{source: source, expected: expected})
+}
+
+func (tr *TestResult) AddExtraItem(source, actual string) {
+	if tr.settings.redact {
+		actual = redactSecret(actual)
+	}
+	tr.extraItems = append(tr.extraItems, Item{source: source, actual: actual})
+}
+
+// AddAllowedExtraItem records an extra item tolerated by test config, which must
+// not fail the test
+func (tr *TestResult) AddAllowedExtraItem(source string) {
+	tr.allowedExtras = append(tr.allowedExtras, source)
+}
+
+func (tr *TestResult) AddSortedList(source, path string) {
+	tr.sortedLists = append(tr.sortedLists, SortedList{source, path})
+}
+
+// AddFailedAssertion records an assertion on rendered resources that did not hold
+func (tr *TestResult) AddFailedAssertion(message string) {
+	tr.failedAssertions = append(tr.failedAssertions, message)
+}
+
+func (tr *TestResult) ShowValues(getValuesYaml func() (string, error)) {
+	tr.getValuesYaml = getValuesYaml
+	if tr.settings.redact {
+		tr.getValuesYaml = func() (string, error) {
+			valuesYaml, err := getValuesYaml()
+			if err != nil {
+				return "", err
+			}
+			return redactValuesYaml(valuesYaml)
+		}
+	}
+}
+
+// compacted returns a copy of result without the full expected and actual content
+// of different items, only keeping their precomputed diff, to bound memory held by
+// results of large manifests once they have been printed
+func (tr *TestResult) compacted() TestResult {
+	result := *tr
+	result.differentItems = make([]Item, len(tr.differentItems))
+	for i, item := range tr.differentItems {
+		result.differentItems[i] = Item{source: item.source, diff: item.diff}
+	}
+	return result
+}
+
+// changedSources returns the distinct sources of all different, missing and extra items
+func (tr *TestResult) changedSources() []string {
+	var sources []string
+	for _, items := range [][]Item{tr.differentItems, tr.missingItems, tr.extraItems} {
+		for _, item := range items {
+			if !contains(sources, item.source) {
+				sources = append(sources, item.source)
+			}
+		}
+	}
+	return sources
+}
+
+// shouldShowValues returns whether coalesced values must be shown for this test
+func (tr *TestResult) shouldShowValues() bool {
+	return showAllValues || (showValues && !tr.isSuccessful())
+}
+
+// unifiedDiff returns the uncolored unified diff between given expected and actual
+// content, with given number of unchanged lines around changes
+func unifiedDiff(expected, actual string, context int) string {
+	return namedUnifiedDiff("expected", "actual", expected, actual, context)
+}
+
+// namedUnifiedDiff returns the uncolored unified diff between given expected and
+// actual content, with given names in its header and given number of unchanged
+// lines around changes
+func namedUnifiedDiff(expectedName, actualName, expected, actual string, context int) string {
+	edits := myers.ComputeEdits(span.URIFromPath(""), expected, actual)
+	diff := gotextdiff.ToUnified(expectedName, actualName, expected, edits)
+	if context != DefaultDiffContext {
+		diff = withDiffContext(diff, expected, context)
+	}
+	unified := fmt.Sprintf("%s", diff)
+	return strings.ReplaceAll(unified, "\\ No newline at end of file\n", "")
+}
+
+func NewPrintBuilder(isUpdate, isInteractive, isDryRun bool) *PrintBuilder {
+	return &PrintBuilder{isUpdate: isUpdate, isInteractive: isInteractive, isDryRun: isDryRun, recordSettings: defaultRecordSettings()}
+}
+
+type PrintBuilder struct {
+	TestResult
+	recordSettings                        recordSettings
+	isUpdate, isInteractive, isDryRun     bool
+	testCount, successCount, skippedCount int
+	longestName                           int
+	results                               []TestResult
+	printedCount, prunedCount             int
+}
+
+func (pb *PrintBuilder) StartAllTests(names []string) {
+	pb.testCount = 0
+	pb.successCount = 0
+	pb.skippedCount = 0
+	pb.results = nil
+	pb.printedCount = 0
+	pb.prunedCount = 0
+
+	// Calculate longest name
+	for _, name := range names {
+		if len(name) > pb.longestName {
+			pb.longestName = len(name)
+		}
+	}
+}
+
+func (pb *PrintBuilder) StartTest(name string) {
+	pb.TestResult = newTestResult(name, pb.recordSettings)
+	pb.testCount++
+}
+
+const (
+	separator1 = "============================================="
+	separator2 = "---------------------------------------------"
+)
+
+func (pb *PrintBuilder) EndTest() error {
+	isSuccessful := pb.isSuccessful()
+	if isSuccessful {
+		pb.successCount++
+	}
+	pb.results = append(pb.results, pb.compacted())
+
+	// Missing items are removed from expected files when updating without review
+	isPruning := pb.isUpdate && !pb.isInteractive
+	if isPruning {
+		pb.prunedCount += len(pb.missingItems)
+	}
+
+	// Only print failures and warnings in quiet mode
+	if quiet && isSuccessful && len(pb.validationWarnings) == 0 && !pb.shouldShowValues() {
+		return nil
+	}
+	pb.printedCount++
+
+	fmt.Println(separator1)
+	fmt.Printf("%s %s", markers.test, pb.name)
+
+	// Add padding to align the results
+	padding := (pb.longestName - len(pb.name)) + 1
+	for i := 0; i < padding; i++ {
+		fmt.Print(" ")
+	}
+
+	var status string
+	if pb.isTimedOut() {
+		status = markers.timedOut
+	} else if pb.runError != nil {
+		status = markers.runError
+	} else if isSuccessful {
+		if pb.isUpdate {
+			status = markers.nothingToUpdate
+		} else {
+			status = markers.passed
+		}
+	} else {
+		if pb.isInteractive && !pb.isSame {
+			status = markers.review
+		} else if pb.isUpdate && !pb.isSame && pb.isDryRun {
+			status = markers.wouldUpdate
+		} else if pb.isUpdate && !pb.isSame {
+			status = markers.updated
+		} else {
+			status = markers.failed
+			if !pb.isValid {
+				status += markers.invalid
+			}
+		}
+	}
+	switch {
+	case noDurations && pb.ignoredCount > 0:
+		fmt.Printf("%s (%d ignored resources)\n", status, pb.ignoredCount)
+	case noDurations:
+		fmt.Println(status)
+	case pb.ignoredCount > 0:
+		fmt.Printf("%s (%s, %d ignored resources)\n", status, formatDuration(pb.duration), pb.ignoredCount)
+	default:
+		fmt.Printf("%s (%s)\n", status, formatDuration(pb.duration))
+	}
+
+	sections := 0
+	if pb.runError != nil {
+		fmt.Println(separator2)
+		fmt.Printf("%s: %v\n", markers.runError, pb.runError)
+		sections++
+	}
+	hasItems := len(pb.differentItems)+len(pb.extraItems)+len(pb.missingItems) > 0
+	if !pb.isSame && (hasItems || pb.isEmptyRender) {
+		if sections < 1 {
+			fmt.Println(separator2)
+		} else {
+			fmt.Println(markers.separator3)
+		}
+		itemSections := 0
+		if len(pb.differentItems) > 0 {
+			for i, differentItem := range pb.differentItems {
+				if i > 0 {
+					fmt.Println(markers.separator3)
+				}
+				if differentItem.path != "" {
+					fmt.Printf("%s %q at %s:\n", markers.different, differentItem.source, differentItem.path)
+				} else {
+					fmt.Printf("%s %q:\n", markers.different, differentItem.source)
+				}
+				if differentItem.expected == differentItem.actual {
+					fmt.Println(markers.redactedOnly)
+					continue
+				}
+				fmt.Println(colorizeDiff(differentItem.unifiedDiff()))
+			}
+			itemSections++
+		}
+		if len(pb.extraItems) > 0 {
+			if itemSections > 0 {
+				fmt.Println(markers.separator3)
+			}
+			for i, extraItem := range pb.extraItems {
+				if i > 0 {
+					fmt.Println(markers.separator3)
+				}
+				fmt.Printf("%s %q:\n%s\n", markers.unexpected, extraItem.source, extraItem.actual)
+			}
+			itemSections++
+		}
+		if len(pb.missingItems) > 0 {
+			if itemSections > 0 {
+				fmt.Println(markers.separator3)
+			}
+			marker := markers.missing
+			if isPruning && pb.isDryRun {
+				marker = markers.wouldPrune
+			} else if isPruning {
+				marker = markers.pruned
+			}
+			for i, missingItem := range pb.missingItems {
+				if i > 0 {
+					fmt.Println(markers.separator3)
+				}
+				fmt.Printf("%s %q:\n%s\n", marker, missingItem.source, missingItem.expected)
+			}
+			itemSections++
+		}
+		if !hasItems {
+			// A new test rendering nothing differs without any item
+			fmt.Println(markers.noResources)
+			itemSections++
+		}
+		sections += itemSections
+	}
+
+	if len(pb.failedAssertions) > 0 {
+		if sections < 1 {
+			fmt.Println(separator2)
+		} else {
+			fmt.Println(markers.separator3)
+		}
+		for _, failedAssertion := range pb.failedAssertions {
+			fmt.Printf("%s: %s\n", markers.failedAssertion, failedAssertion)
+		}
+		sections++
+	}
+
+	if len(pb.sortedLists) > 0 {
+		if sections < 1 {
+			fmt.Println(separator2)
+		} else {
+			fmt.Println(markers.separator3)
+		}
+		for _, sortedList := range pb.sortedLists {
+			fmt.Printf("%s %q in %q\n", markers.sorted, sortedList.path, sortedList.source)
+		}
+		sections++
+	}
+
+	if len(pb.allowedExtras) > 0 {
+		if sections < 1 {
+			fmt.Println(separator2)
+		} else {
+			fmt.Println(markers.separator3)
+		}
+		for _, source := range pb.allowedExtras {
+			fmt.Printf("%s %q\n", markers.allowedExtra, source)
+		}
+		sections++
+	}
+
+	if !pb.isValid {
+		if sections < 1 {
+			fmt.Println(separator2)
+		} else {
+			fmt.Println(markers.separator3)
+		}
+		for i, validationError := range pb.validationErrors {
+			if i > 0 {
+				fmt.Println(markers.separator3)
+			}
+			fmt.Printf("%s %q:\n%s\n", markers.invalidResource, validationError.signature, validationError.error)
+		}
+		sections++
+	}
+
+	if len(pb.validationWarnings) > 0 {
+		if sections < 1 {
+			fmt.Println(separator2)
+		} else {
+			fmt.Println(markers.separator3)
+		}
+		for i, validationWarning := range pb.validationWarnings {
+			if i > 0 {
+				fmt.Println(markers.separator3)
+			}
+			fmt.Printf("%s %q (warning only):\n%s\n", markers.invalidWarning, validationWarning.signature, validationWarning.error)
+		}
+		sections++
+	}
+
+	// Show values for all or only failed tests
+	if pb.shouldShowValues() {
+		if sections < 1 {
+			fmt.Println(separator2)
+		} else {
+			fmt.Println(markers.separator3)
+		}
+		valuesYaml, err := pb.getValuesYaml()
+		if err != nil {
+			return fmt.Errorf("failed to get values yaml: %w", err)
+		}
+		fmt.Printf("%s:\n", markers.values)
+		fmt.Println(valuesYaml)
+	}
+	return nil
+}
+
+const (
+	reset  = "\033[0m"
+	red    = "\033[31m"
+	green  = "\033[32m"
+	yellow = "\033[33m"
+)
+
+func colorizeDiff(diff string) string {
+	if noColor {
+		return strings.TrimSpace(diff)
+	}
+	var coloredDiff strings.Builder
+	lines := strings.Split(diff, "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "-") {
+			coloredDiff.WriteString(green)
+		} else if strings.HasPrefix(line, "+") {
+			coloredDiff.WriteString(red)
+		} else if strings.HasPrefix(line, "@") {
+			coloredDiff.WriteString(yellow)
+		} else {
+			coloredDiff.WriteString(reset)
+		}
+		coloredDiff.WriteString(line)
+		coloredDiff.WriteString(reset)
+		coloredDiff.WriteString("\n")
+	}
+	return strings.TrimSpace(coloredDiff.String())
+}
+
+func (pb *PrintBuilder) EndUpdateReview(isAccepted bool) {
+	if isAccepted {
+		fmt.Println(markers.updated)
+		pb.prunedCount += len(pb.missingItems)
+	} else {
+		fmt.Println(markers.skippedUpdate)
+		pb.skippedCount++
+	}
+}
+
+func (pb *PrintBuilder) EndAllTests() {
+	if !quiet || pb.printedCount > 0 {
+		fmt.Println(separator1)
+	}
+	if pb.skippedCount > 0 {
+		fmt.Printf("%s %d tests\n", markers.skippedUpdates, pb.skippedCount)
+	}
+	if pb.isUpdate && pb.isDryRun {
+		fmt.Printf("%s of %d tests\n", markers.wouldUpdate, pb.wouldUpdateCount())
+	}
+	if pb.prunedCount > 0 && pb.isDryRun {
+		fmt.Printf("%s %d stale resources\n", markers.wouldPrune, pb.prunedCount)
+	} else if pb.prunedCount > 0 {
+		fmt.Printf("%s %d stale resources\n", markers.pruned, pb.prunedCount)
+	}
+	hasChangedSources := false
+	for _, result := range pb.results {
+		sources := result.changedSources()
+		if len(sources) == 0 {
+			continue
+		}
+		if !hasChangedSources {
+			fmt.Printf("%s:\n", markers.changedSources)
+			hasChangedSources = true
+		}
+		fmt.Printf("  %s %s\n", markers.test, result.name)
+		for _, source := range sources {
+			fmt.Printf("     %s\n", source)
+		}
+	}
+	if hasChangedSources {
+		fmt.Println(separator2)
+	}
+	if slowest > 0 && len(pb.results) > 0 {
+		fmt.Printf("%s:\n", markers.slowest)
+		for _, result := range slowestResults(pb.results, slowest) {
+			fmt.Printf("  %s %s (%s)\n", markers.test, result.name, formatDuration(result.duration))
+		}
+		fmt.Println(separator2)
+	}
+	hasTimedOut := false
+	for _, result := range pb.results {
+		if !result.isTimedOut() {
+			continue
+		}
+		if !hasTimedOut {
+			fmt.Printf("%s:\n", markers.timedOut)
+			hasTimedOut = true
+		}
+		fmt.Printf("  %s %s\n", markers.test, result.name)
+	}
+	if hasTimedOut {
+		fmt.Println(separator2)
+	}
+	if pb.testCount == 0 {
+		fmt.Println(markers.noTests)
+	} else if pb.IsSuccessful() {
+		fmt.Printf("%s %d tests passed\n", markers.allPassed, pb.testCount)
+	} else {
+		fmt.Printf("%s %d tests failed out of %d\n", markers.someFailed, pb.testCount-pb.successCount, pb.testCount)
+	}
+	if !quiet {
+		fmt.Println(separator1)
+	}
+}
+
+// wouldUpdateCount returns the number of tests whose expected files differ from
+// rendered manifests, excluding those only failing validation or assertions, which
+// updating would not fix
+func (pb *PrintBuilder) wouldUpdateCount() int {
+	count := 0
+	for _, result := range pb.results {
+		if !result.isSame && result.runError == nil {
+			count++
+		}
+	}
+	return count
+}
+
+func (pb *PrintBuilder) IsSuccessful() bool {
+	return pb.successCount == pb.testCount
+}
+
+func (pb *PrintBuilder) Results() []TestResult {
+	return pb.results
+}
+
+// slowestResults returns up to count of given results, ordered by decreasing duration
+func slowestResults(results []TestResult, count int) []TestResult {
+	sorted := make([]TestResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].duration > sorted[j].duration
+	})
+	if len(sorted) > count {
+		sorted = sorted[:count]
+	}
+	return sorted
+}
+
+// formatDuration formats given duration rounded to the millisecond, or to the
+// microsecond if shorter than a millisecond, or as "-" if durations are disabled
+func formatDuration(duration time.Duration) string {
+	if noDurations {
+		return "-"
+	}
+	if duration < time.Millisecond {
+		text := duration.Round(time.Microsecond).String()
+		if ascii {
+			text = strings.ReplaceAll(text, "µs", "us")
+		}
+		return text
+	}
+	return duration.Round(time.Millisecond).String()
+}
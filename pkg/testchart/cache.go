@@ -0,0 +1,102 @@
+package testchart
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheDirName is the name of the directory, in user cache directory, holding the
+// files recording the outcome of each test in previous runs, to rerun only failed
+// tests, with one file per tests directory
+const cacheDirName = "testchart"
+
+// runCache holds the outcome of each test as of the last run including it
+type runCache struct {
+	Tests map[string]bool `json:"tests"`
+}
+
+// runCachePath returns the path of the cache file of given tests directory, which is
+// kept in user cache directory rather than in tests directory, so that it does not
+// end up committed along with tests, and is named after a hash of the absolute path
+// of tests directory
+func runCachePath(testPath string) (string, error) {
+	absolutePath, err := filepath.Abs(testPath)
+	if err != nil {
+		return "", err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(absolutePath))
+	return filepath.Join(cacheDir, cacheDirName, hex.EncodeToString(hash[:16])+".json"), nil
+}
+
+// loadRunCache loads the cache file of given tests directory, returning an empty
+// cache if it does not exist
+func loadRunCache(testPath string) (runCache, error) {
+	cache := runCache{Tests: map[string]bool{}}
+	cachePath, err := runCachePath(testPath)
+	if err != nil {
+		return cache, err
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cache, nil
+		}
+		return cache, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return cache, fmt.Errorf("parsing %q: %w", cachePath, err)
+	}
+	if cache.Tests == nil {
+		cache.Tests = map[string]bool{}
+	}
+	return cache, nil
+}
+
+// saveRunCache records the outcome of given results in the cache file of given tests
+// directory, keeping the outcome of tests that were not run
+func saveRunCache(testPath string, results []TestResult) error {
+	cachePath, err := runCachePath(testPath)
+	if err != nil {
+		return err
+	}
+	cache, err := loadRunCache(testPath)
+	if err != nil {
+		// Start afresh rather than failing on a corrupted cache
+		cache = runCache{Tests: map[string]bool{}}
+	}
+	for _, result := range results {
+		cache.Tests[result.name] = result.isSuccessful()
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(cachePath, append(data, '\n'), 0o644)
+}
+
+// filterFailedTests returns the given tests that failed in the last run including them
+func filterFailedTests(testPath string, testNames []string) ([]string, error) {
+	cache, err := loadRunCache(testPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading results of last run: %w", err)
+	}
+	var failed []string
+	for _, testName := range testNames {
+		if isSuccessful, ok := cache.Tests[testName]; ok && !isSuccessful {
+			failed = append(failed, testName)
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,97 @@
+package testchart
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+// CompareManifest compares the manifest of given file (or stdin, if "-") against
+// the expected files of given test, without rendering chart, printing differences
+// the same way as a regular run, and returns the exit code reflecting the outcome
+// (eg: for reproducing differences of manifests rendered in another environment)
+func CompareManifest(testName, actualPath string, opts RunOptions) (int, error) {
+	config, err := loadConfig(opts)
+	if err != nil {
+		return ExitCodeError, fmt.Errorf("loading config: %w", err)
+	}
+	opts = applyConfig(opts, config)
+
+	testDir := filepath.Join(opts.TestPath, testName)
+	if !hasExpected(testDir) {
+		return ExitCodeError, fmt.Errorf("test %q has no expected files to compare against", testName)
+	}
+	expectedManifest, err := readExpectedManifest(testDir)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	actualManifest, err := readActualManifest(actualPath)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	testConfig, err := loadTestConfig(testDir)
+	if err != nil {
+		return ExitCodeError, fmt.Errorf("loading test config: %w", err)
+	}
+
+	// Versions of chart are only needed for masking version labels
+	var metadata *chart.Metadata
+	if opts.MaskVersions {
+		chartPath, err := locateChart(opts.Chart, cli.New(), action.NewInstall(new(action.Configuration)))
+		if err != nil {
+			return ExitCodeError, fmt.Errorf("locating chart: %w", err)
+		}
+		theChart, err := loadChart(chartPath)
+		if err != nil {
+			return ExitCodeError, fmt.Errorf("loading chart: %w", err)
+		}
+		metadata = theChart.Metadata
+	}
+
+	builder, err := newBuilder(outputFormat, false, false, false, recordSettings{redact: redact, diffContext: diffContext})
+	if err != nil {
+		return ExitCodeError, err
+	}
+	builder.StartAllTests([]string{testName})
+	builder.StartTest(testName)
+	startTime := time.Now()
+	// Contrary to a regular run, actual manifest was not rendered according to options
+	actualManifest = trimHookSections(actualManifest, opts)
+	if len(opts.ShowOnly) > 0 {
+		actualManifest = filterManifest(actualManifest, opts.ShowOnly, true)
+	}
+	expectedManifest, actualManifest, err = prepareManifests(testDir, expectedManifest, actualManifest, testConfig, metadata, opts)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	opts.AllowedExtras = append(append([]string{}, opts.AllowedExtras...), testConfig.AllowedExtras...)
+	builder.SetTestComparisonResult(compareManifests(builder, expectedManifest, actualManifest, opts))
+	builder.SetDuration(time.Since(startTime))
+	if err := builder.EndTest(); err != nil {
+		return ExitCodeError, err
+	}
+	builder.EndAllTests()
+	return exitCodeOf(builder.Results()), nil
+}
+
+// readActualManifest reads the manifest of given file, or of stdin if "-"
+func readActualManifest(path string) (string, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading actual manifest from stdin: %w", err)
+		}
+		return normalizeSourceHeaders(string(data)), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading actual manifest: %w", err)
+	}
+	return normalizeSourceHeaders(string(data)), nil
+}
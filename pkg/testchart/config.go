@@ -0,0 +1,197 @@
+package testchart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// configFileName is the name of the optional config file in tests directory
+const configFileName = "tests.yaml"
+
+// Config holds the settings of the optional tests.yaml file
+type Config struct {
+	Release              string            `yaml:"release"`
+	Namespace            string            `yaml:"namespace"`
+	SkipHooks            bool              `yaml:"skipHooks"`
+	SkipTestHooks        bool              `yaml:"skipTestHooks"`
+	SortLists            []ListSort        `yaml:"sortLists"`
+	SortRBACRules        bool              `yaml:"sortRbacRules"`
+	StripStatus          bool              `yaml:"stripStatus"`
+	MaskVersions         bool              `yaml:"maskVersions"`
+	IgnoreSource         bool              `yaml:"ignoreSource"`
+	Structural           bool              `yaml:"structural"`
+	SchemaPath           string            `yaml:"schemaPath"`
+	SchemaDef            string            `yaml:"schemaDef"`
+	SchemaLocations      []string          `yaml:"schemaLocations"`
+	FailOnMissingSchemas bool              `yaml:"failOnMissingSchemas"`
+	StrictValidation     *bool             `yaml:"strictValidation"`
+	SkipValidation       bool              `yaml:"skipValidation"`
+	ValidationWarnOnly   bool              `yaml:"validationWarnOnly"`
+	WarningsAsErrors     bool              `yaml:"warningsAsErrors"`
+	Substitutions        []Substitution    `yaml:"substitutions"`
+	IgnoreLines          []string          `yaml:"ignoreLines"`
+	OnlyLines            []string          `yaml:"onlyLines"`
+	SplitExpected        bool              `yaml:"splitExpected"`
+	JSONKinds            []string          `yaml:"jsonKinds"`
+	IgnoreKinds          []string          `yaml:"ignoreKinds"`
+	RequiredLabels       map[string]string `yaml:"requiredLabels"`
+	ExpandEnv            bool              `yaml:"expandEnv"`
+	PostRenderer         *PostRenderer     `yaml:"postRenderer"`
+}
+
+// PostRenderer specifies an external command post-rendering manifests, same as
+// helm's --post-renderer flag, receiving rendered manifests on its stdin and
+// writing post-rendered manifests to its stdout
+type PostRenderer struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+}
+
+// configFilePath returns the path of config file, either explicitly configured or
+// else found in tests directory
+func configFilePath(opts RunOptions) string {
+	if opts.ConfigPath != "" {
+		return opts.ConfigPath
+	}
+	return filepath.Join(opts.TestPath, configFileName)
+}
+
+// loadConfig loads the config file of given options, falling back to defaults if it
+// does not exist, unless its path was explicitly configured
+func loadConfig(opts RunOptions) (Config, error) {
+	var config Config
+	configPath := configFilePath(opts)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && opts.ConfigPath == "" {
+			return config, nil
+		}
+		return config, err
+	}
+
+	if err := unmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("parsing %q: %w", configPath, err)
+	}
+	if config.PostRenderer != nil && config.PostRenderer.Command == "" {
+		return config, fmt.Errorf("parsing %q: post-renderer command must not be empty", configPath)
+	}
+	for name := range config.RequiredLabels {
+		if name == "" {
+			return config, fmt.Errorf("parsing %q: required label names must not be empty", configPath)
+		}
+	}
+	Logf(LogLevelDebug, "Loaded config file %s", configPath)
+	return config, nil
+}
+
+// cueSchemaOptions returns the path and definition name of cue schema, from given
+// options or else given config or else defaults, along with whether schema file was
+// explicitly configured and must therefore exist
+func cueSchemaOptions(opts RunOptions, config Config) (string, string, bool) {
+	path := opts.SchemaPath
+	if path == "" {
+		path = config.SchemaPath
+	}
+	isRequired := path != ""
+	if path == "" {
+		path = cueSchemaFileName
+	}
+
+	def := opts.SchemaDef
+	if def == "" {
+		def = config.SchemaDef
+	}
+	if def == "" {
+		def = cueSchemaDef
+	}
+	return path, def, isRequired
+}
+
+// testConfigFileName is the name of the optional config file in a test directory
+const testConfigFileName = "test.yaml"
+
+// TestConfig holds the settings of the optional test.yaml file, overriding global
+// options for a single test
+type TestConfig struct {
+	Namespace     *string  `yaml:"namespace"`
+	Release       *string  `yaml:"release"`
+	APIVersions   []string `yaml:"apiVersions"`
+	JSONKinds     []string `yaml:"jsonKinds"`
+	Tags          []string `yaml:"tags"`
+	AllowedExtras []string `yaml:"allowedExtras"`
+}
+
+// apiVersionPattern matches the API versions that can be made available to a test,
+// in the form "version", "group/version" or "group/version/Kind"
+// (eg: "v1", "networking.k8s.io/v1" or "networking.k8s.io/v1/Ingress")
+var apiVersionPattern = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?v[0-9]+((alpha|beta)[0-9]+)?(/[A-Z][A-Za-z0-9]*)?$`)
+
+// loadTestConfig loads the config file from given test directory, falling back to
+// defaults if it does not exist
+func loadTestConfig(testDir string) (TestConfig, error) {
+	var config TestConfig
+	configPath := filepath.Join(testDir, testConfigFileName)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return config, nil
+		}
+		return config, err
+	}
+
+	if err := unmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("parsing %q: %w", configPath, err)
+	}
+	if config.Namespace != nil && *config.Namespace == "" {
+		return config, fmt.Errorf("parsing %q: namespace must not be empty", configPath)
+	}
+	if config.Release != nil && *config.Release == "" {
+		return config, fmt.Errorf("parsing %q: release must not be empty", configPath)
+	}
+	for _, apiVersion := range config.APIVersions {
+		if !apiVersionPattern.MatchString(apiVersion) {
+			return config, fmt.Errorf("parsing %q: invalid api version %q (expecting version, group/version or group/version/Kind)", configPath, apiVersion)
+		}
+	}
+	for _, tag := range config.Tags {
+		if tag == "" {
+			return config, fmt.Errorf("parsing %q: tags must not be empty", configPath)
+		}
+	}
+	for _, allowedExtra := range config.AllowedExtras {
+		if kind, name, _ := strings.Cut(allowedExtra, "/"); kind == "" || strings.Contains(allowedExtra, "/") && name == "" {
+			return config, fmt.Errorf("parsing %q: invalid allowed extra %q (expecting Kind or Kind/name)", configPath, allowedExtra)
+		}
+	}
+	return config, nil
+}
+
+// testIgnoreFileName is the name of the optional file in a test directory listing
+// ignore patterns that apply to that test only
+const testIgnoreFileName = "ignore.txt"
+
+// loadTestIgnorePatterns loads the ignore patterns from given test directory, one
+// regular expression per line, skipping blank lines and lines starting with "#"
+func loadTestIgnorePatterns(testDir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(testDir, testIgnoreFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,75 @@
+package testchart
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// renderedSources returns the distinct template paths of all resources in given manifest
+func renderedSources(manifest string) []string {
+	var sources []string
+	for _, line := range strings.Split(manifest, "\n") {
+		if source, ok := strings.CutPrefix(line, "# Source: "); ok {
+			if source = strings.TrimSpace(source); !contains(sources, source) {
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources
+}
+
+// chartTemplates returns the paths of all templates of given chart and its subcharts
+// that can render resources, in the same format as manifest sources (eg:
+// "mychart/templates/deployment.yaml"), excluding partials and notes
+func chartTemplates(theChart *chart.Chart, prefix string) []string {
+	prefix = path.Join(prefix, theChart.Name())
+	var templates []string
+	for _, template := range theChart.Templates {
+		name := path.Base(template.Name)
+		if strings.HasPrefix(name, "_") || name == "NOTES.txt" {
+			continue
+		}
+		templates = append(templates, path.Join(prefix, template.Name))
+	}
+	for _, dependency := range theChart.Dependencies() {
+		templates = append(templates, chartTemplates(dependency, path.Join(prefix, "charts"))...)
+	}
+	sort.Strings(templates)
+	return templates
+}
+
+// printCoverage prints the percentage of chart templates rendered by at least one of
+// given test results, along with the list of templates never rendered
+func printCoverage(theChart *chart.Chart, results []TestResult) {
+	rendered := map[string]bool{}
+	for _, result := range results {
+		for _, source := range result.renderedSources {
+			rendered[source] = true
+		}
+	}
+
+	templates := chartTemplates(theChart, "")
+	var uncovered []string
+	for _, template := range templates {
+		if !rendered[template] {
+			uncovered = append(uncovered, template)
+		}
+	}
+
+	percentage := 100.0
+	if len(templates) > 0 {
+		percentage = float64(len(templates)-len(uncovered)) * 100 / float64(len(templates))
+	}
+	fmt.Printf("%s: %.0f%% (%d of %d templates rendered)\n", markers.coverage, percentage, len(templates)-len(uncovered), len(templates))
+	if len(uncovered) > 0 {
+		fmt.Printf("%s:\n", markers.neverRendered)
+		for _, template := range uncovered {
+			fmt.Printf("   %s\n", template)
+		}
+	}
+	fmt.Println(separator1)
+}
@@ -0,0 +1,55 @@
+package testchart
+
+import (
+	"fmt"
+	"os"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// ensureDependencies checks that dependencies of given chart, loaded from given path,
+// are present in its charts directory. If they are not and isUpdated is true, they
+// are first downloaded (from Chart.lock if any) and chart is reloaded, which requires
+// network access, retried up to given number of times on transient errors.
+// Dependencies already present are never downloaded again, for offline runs to be
+// reliable.
+func ensureDependencies(theChart *chart.Chart, chartPath string, settings *cli.EnvSettings, isUpdated bool, retries int) (*chart.Chart, error) {
+	err := action.CheckDependencies(theChart, theChart.Metadata.Dependencies)
+	if err == nil {
+		return theChart, nil
+	}
+	if !isUpdated {
+		return nil, fmt.Errorf("%w (run helm dependency build, or use --update-deps)", err)
+	}
+	if info, statErr := os.Stat(chartPath); statErr != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%w (updating dependencies requires a local chart directory)", err)
+	}
+
+	registryClient, err := registry.NewClient(
+		registry.ClientOptDebug(settings.Debug),
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptWriter(os.Stderr),
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating registry client: %w", err)
+	}
+	manager := &downloader.Manager{
+		Out:              os.Stderr,
+		ChartPath:        chartPath,
+		Getters:          getter.All(settings),
+		RegistryClient:   registryClient,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+		Debug:            settings.Debug,
+	}
+	if err := withRetries("Updating dependencies", retries, manager.Build); err != nil {
+		return nil, fmt.Errorf("updating dependencies: %w", err)
+	}
+	return loadChart(chartPath)
+}
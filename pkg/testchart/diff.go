@@ -0,0 +1,91 @@
+package testchart
+
+import (
+	"strings"
+
+	"github.com/hexops/gotextdiff"
+)
+
+// DefaultDiffContext is the number of unchanged lines gotextdiff shows around changes
+const DefaultDiffContext = 3
+
+// withDiffContext returns given unified diff of given original content regrouped into
+// hunks with given number of unchanged lines of context around changes
+func withDiffContext(unified gotextdiff.Unified, original string, context int) gotextdiff.Unified {
+	if context < 0 {
+		context = 0
+	}
+
+	// Restore full sequence of line operations, including unchanged lines between hunks
+	originalLines := strings.SplitAfter(original, "\n")
+	if originalLines[len(originalLines)-1] == "" {
+		originalLines = originalLines[:len(originalLines)-1]
+	}
+	var lines []gotextdiff.Line
+	pos := 0
+	for _, hunk := range unified.Hunks {
+		for ; pos < hunk.FromLine-1 && pos < len(originalLines); pos++ {
+			lines = append(lines, gotextdiff.Line{Kind: gotextdiff.Equal, Content: originalLines[pos]})
+		}
+		for _, line := range hunk.Lines {
+			lines = append(lines, line)
+			if line.Kind != gotextdiff.Insert {
+				pos++
+			}
+		}
+	}
+	for ; pos < len(originalLines); pos++ {
+		lines = append(lines, gotextdiff.Line{Kind: gotextdiff.Equal, Content: originalLines[pos]})
+	}
+
+	// Line numbers in original and modified content of each line operation
+	fromLines := make([]int, len(lines))
+	toLines := make([]int, len(lines))
+	fromLine, toLine := 1, 1
+	for i, line := range lines {
+		fromLines[i], toLines[i] = fromLine, toLine
+		if line.Kind != gotextdiff.Insert {
+			fromLine++
+		}
+		if line.Kind != gotextdiff.Delete {
+			toLine++
+		}
+	}
+
+	// Regroup changes into hunks, merging those separated by less than twice the context
+	result := gotextdiff.Unified{From: unified.From, To: unified.To}
+	var hunk *gotextdiff.Hunk
+	lastChange := -1
+	endHunk := func() {
+		end := lastChange + 1 + context
+		if end > len(lines) {
+			end = len(lines)
+		}
+		hunk.Lines = append(hunk.Lines, lines[lastChange+1:end]...)
+		result.Hunks = append(result.Hunks, hunk)
+	}
+	for i, line := range lines {
+		if line.Kind == gotextdiff.Equal {
+			continue
+		}
+		if hunk == nil || i-lastChange-1 > 2*context {
+			if hunk != nil {
+				endHunk()
+			}
+			start := i - context
+			if start < 0 {
+				start = 0
+			}
+			hunk = &gotextdiff.Hunk{FromLine: fromLines[start], ToLine: toLines[start]}
+			hunk.Lines = append(hunk.Lines, lines[start:i]...)
+		} else {
+			hunk.Lines = append(hunk.Lines, lines[lastChange+1:i]...)
+		}
+		hunk.Lines = append(hunk.Lines, line)
+		lastChange = i
+	}
+	if hunk != nil {
+		endHunk()
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package testchart
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffBuilder renders the differences of all tests as a single aggregated unified
+// diff, suitable for reviewing the impact of a change (eg: in a pull request
+// description). Contrary to PrintBuilder, nothing is printed until all tests have
+// ended, and errors are printed to stderr.
+type DiffBuilder struct {
+	TestResult
+	recordSettings recordSettings
+	results        []TestResult
+}
+
+func NewDiffBuilder() *DiffBuilder {
+	return &DiffBuilder{recordSettings: defaultRecordSettings()}
+}
+
+func (db *DiffBuilder) StartAllTests(names []string) {
+	db.results = nil
+}
+
+func (db *DiffBuilder) StartTest(name string) {
+	db.TestResult = newTestResult(name, db.recordSettings)
+}
+
+func (db *DiffBuilder) EndTest() error {
+	db.results = append(db.results, db.TestResult)
+	return nil
+}
+
+// EndUpdateReview does nothing, as interactive mode is only supported with text output
+func (db *DiffBuilder) EndUpdateReview(isAccepted bool) {
+}
+
+func (db *DiffBuilder) EndAllTests() {
+	var sb strings.Builder
+	for _, result := range db.results {
+		if result.runError != nil {
+			Logf(LogLevelError, "Test %s: %v", result.name, result.runError)
+		}
+		for _, item := range result.differentItems {
+			writeNamedDiff(&sb, result, item)
+		}
+		for _, item := range result.missingItems {
+			writeNamedDiff(&sb, result, item)
+		}
+		for _, item := range result.extraItems {
+			writeNamedDiff(&sb, result, item)
+		}
+	}
+	fmt.Print(sb.String())
+}
+
+// writeNamedDiff writes the unified diff of given item, with its test name and
+// source in diff header
+func writeNamedDiff(sb *strings.Builder, result TestResult, item Item) {
+	name := fmt.Sprintf("%s: %s", result.name, item.source)
+	sb.WriteString(namedUnifiedDiff("expected/"+name, "actual/"+name, item.expected, item.actual, result.settings.diffContext))
+}
+
+func (db *DiffBuilder) IsSuccessful() bool {
+	for _, result := range db.results {
+		if !result.isSuccessful() {
+			return false
+		}
+	}
+	return true
+}
+
+func (db *DiffBuilder) Results() []TestResult {
+	return db.results
+}
@@ -0,0 +1,33 @@
+package testchart
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// writeDiffs writes the plain unified diffs of all different, missing and extra items
+// of given test results to given file, with test names and sources as headers
+func writeDiffs(path string, results []TestResult) error {
+	var sb strings.Builder
+	for _, result := range results {
+		if len(result.differentItems)+len(result.missingItems)+len(result.extraItems) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s\n%s %s\n", separator1, markers.test, result.name)
+		writeItemDiffs(&sb, markers.different, result.differentItems)
+		writeItemDiffs(&sb, markers.unexpected, result.extraItems)
+		writeItemDiffs(&sb, markers.missing, result.missingItems)
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("writing diffs to %q: %w", path, err)
+	}
+	return nil
+}
+
+func writeItemDiffs(sb *strings.Builder, title string, items []Item) {
+	for _, item := range items {
+		fmt.Fprintf(sb, "%s\n%s %q:\n", separator2, title, item.source)
+		sb.WriteString(item.unifiedDiff())
+	}
+}
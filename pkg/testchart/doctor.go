@@ -0,0 +1,101 @@
+package testchart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+// RunDoctor runs a series of preflight checks on chart and tests setup, printing a
+// consolidated report of all problems found, and returns whether all checks passed
+func RunDoctor(opts RunOptions) bool {
+	problemCount := 0
+	check := func(name string, err error) bool {
+		if err != nil {
+			fmt.Printf("%s %s:\n   %v\n", markers.checkFailed, name, err)
+			problemCount++
+			return false
+		}
+		fmt.Printf("%s %s\n", markers.checkPassed, name)
+		return true
+	}
+
+	fmt.Println(separator1)
+	fmt.Println(markers.doctor + " Checking chart and tests setup")
+	fmt.Println(separator1)
+
+	// Chart
+	var theChart *chart.Chart
+	installAction := action.NewInstall(new(action.Configuration))
+	chartPath, err := locateChart(opts.Chart, cli.New(), installAction)
+	if check("Chart located", err) {
+		theChart, err = loadChart(chartPath)
+		if check("Chart loads", err) {
+			check("Chart dependencies resolved", action.CheckDependencies(theChart, theChart.Metadata.Dependencies))
+		}
+	}
+
+	// Config and schema
+	config, err := loadConfig(opts)
+	check("Config file is valid", err)
+	_, err = loadCueSchema(cueSchemaOptions(opts, config))
+	check("Schema compiles", err)
+
+	// Tests
+	testNames, err := discoverTests(opts.TestPath)
+	if err == nil && len(testNames) == 0 {
+		err = fmt.Errorf("no test directories found in %q", opts.TestPath)
+	}
+	if check("Tests discoverable", err) {
+		for _, testName := range testNames {
+			check(fmt.Sprintf("Test %s", testName), checkTestFiles(filepath.Join(opts.TestPath, testName), config.ExpandEnv))
+		}
+	}
+
+	fmt.Println(separator1)
+	if problemCount == 0 {
+		fmt.Println(markers.noProblems)
+	} else {
+		fmt.Printf("%s %d problems found\n", markers.problems, problemCount)
+	}
+	fmt.Println(separator1)
+	return problemCount == 0
+}
+
+// checkTestFiles returns an error if given test directory lacks a valid values file,
+// or an expected file (or expected error file), or has an invalid config file
+func checkTestFiles(testDir string, isEnvExpanded bool) error {
+	var errs []error
+	valuesPath := valuesFilePath(testDir)
+	if _, err := loadValuesFile(valuesPath, isEnvExpanded); err != nil {
+		errs = append(errs, fmt.Errorf("loading %s: %w", filepath.Base(valuesPath), err))
+	}
+	if fileExists(filepath.Join(testDir, valuesFileName)) && fileExists(filepath.Join(testDir, jsonValuesFileName)) {
+		errs = append(errs, fmt.Errorf("both %s and %s found, %s is ignored", valuesFileName, jsonValuesFileName, jsonValuesFileName))
+	}
+	if _, err := loadTestConfig(testDir); err != nil {
+		errs = append(errs, err)
+	}
+	if patterns, err := loadTestIgnorePatterns(testDir); err != nil {
+		errs = append(errs, fmt.Errorf("loading %s: %w", testIgnoreFileName, err))
+	} else if _, err := compileIgnorePatterns(patterns); err != nil {
+		errs = append(errs, fmt.Errorf("loading %s: %w", testIgnoreFileName, err))
+	}
+	if _, err := loadAssertions(testDir); err != nil {
+		errs = append(errs, fmt.Errorf("loading %s: %w", assertionsFileName, err))
+	}
+	if !hasExpected(testDir) && !fileExists(filepath.Join(testDir, expectedErrorFileName)) && !fileExists(filepath.Join(testDir, assertionsFileName)) {
+		errs = append(errs, fmt.Errorf("missing %s (or %s directory, %s or %s), run `testchart update` to create it", expectedFileName, expectedDirName, expectedErrorFileName, assertionsFileName))
+	}
+	return errors.Join(errs...)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,45 @@
+package testchart
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkDuplicateResources reports resources of given manifest sharing the same kind,
+// namespace and name, which kubernetes would reject, along with the templates
+// rendering them. Resources without a namespace are considered to be in given one.
+func checkDuplicateResources(builder Builder, manifest, namespace string, opts RunOptions) {
+	var keys []string
+	sourcesByKey := map[string][]string{}
+	for _, chunk := range strings.Split(manifest, "---\n# Source: ") {
+		source, content, ok := strings.Cut(strings.TrimSpace(chunk), "\n")
+		if !ok {
+			continue
+		}
+		var header resourceHeader
+		if err := yaml.Unmarshal([]byte(content), &header); err != nil || header.Kind == "" || header.Metadata.Name == "" {
+			continue
+		}
+		resourceNamespace := header.Metadata.Namespace
+		if resourceNamespace == "" {
+			resourceNamespace = namespace
+		}
+		key := fmt.Sprintf("%s %s/%s", header.Kind, resourceNamespace, header.Metadata.Name)
+		if _, ok := sourcesByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		sourcesByKey[key] = append(sourcesByKey[key], strings.TrimSpace(source))
+	}
+
+	addValidationError := builder.AddValidationError
+	if opts.ValidationWarnOnly {
+		addValidationError = builder.AddValidationWarning
+	}
+	for _, key := range keys {
+		if sources := sourcesByKey[key]; len(sources) > 1 {
+			addValidationError(key, "duplicate resource rendered by "+strings.Join(sources, ", "))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package testchart
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envPlaceholderPattern matches environment variable placeholders in values files,
+// in the form ${VAR} or ${VAR:-default}
+var envPlaceholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// readValuesFile reads given values file, optionally expanding its environment
+// variable placeholders
+func readValuesFile(filePath string, isEnvExpanded bool) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil || !isEnvExpanded {
+		return data, err
+	}
+	return expandEnvPlaceholders(data, filePath)
+}
+
+// expandEnvPlaceholders replaces environment variable placeholders of given data,
+// read from given file, with values of those variables in process environment, or
+// their default values. Unset variables without default values are reported as errors.
+func expandEnvPlaceholders(data []byte, filePath string) ([]byte, error) {
+	var missing []string
+	expanded := envPlaceholderPattern.ReplaceAllStringFunc(string(data), func(placeholder string) string {
+		match := envPlaceholderPattern.FindStringSubmatch(placeholder)
+		if value, ok := os.LookupEnv(match[1]); ok {
+			return value
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		if !contains(missing, match[1]) {
+			missing = append(missing, match[1])
+		}
+		return placeholder
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("environment variables referenced in %q are not set: %s", filePath, strings.Join(missing, ", "))
+	}
+	return []byte(expanded), nil
+}
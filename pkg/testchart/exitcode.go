@@ -0,0 +1,28 @@
+package testchart
+
+// Exit codes of run and update commands, reflecting the most severe class of failure
+// among tests
+const (
+	ExitCodeSuccess   = 0
+	ExitCodeDifferent = 1
+	ExitCodeInvalid   = 2
+	ExitCodeError     = 3
+)
+
+// exitCodeOf returns the exit code reflecting given test results, where execution
+// errors (eg: chart could not be rendered) prevail over validation failures, which
+// prevail over differences with expected files (or failed assertions)
+func exitCodeOf(results []TestResult) int {
+	exitCode := ExitCodeSuccess
+	for _, result := range results {
+		switch {
+		case result.runError != nil:
+			return ExitCodeError
+		case !result.isValid:
+			exitCode = ExitCodeInvalid
+		case !result.isSuccessful() && exitCode == ExitCodeSuccess:
+			exitCode = ExitCodeDifferent
+		}
+	}
+	return exitCode
+}
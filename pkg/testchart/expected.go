@@ -0,0 +1,232 @@
+package testchart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// expectedFileName is the name of the file holding expected manifest of a test
+const expectedFileName = "expected.yaml"
+
+// actualFileName is the name of the file holding rendered manifest of a test, saved
+// for troubleshooting
+const actualFileName = "actual.yaml"
+
+// expectedDirName is the name of the directory holding expected manifest of a test
+// split into one file per resource, as an alternative to expected file
+const expectedDirName = "expected"
+
+// expectedHooksDirName is the name of the sub-directory of expected directory
+// holding hook resources
+const expectedHooksDirName = "hooks"
+
+// expectedTestHooksDirName is the name of the sub-directory of expected directory
+// holding test hook resources
+const expectedTestHooksDirName = "test-hooks"
+
+// emptyExpectedFileName is the name of the file of expected directory marking that
+// test renders no resources at all, for the directory not to be empty
+const emptyExpectedFileName = "empty.yaml"
+
+// emptyManifestMarker is the content of expected files of tests rendering no
+// resources at all, which is ignored when comparing manifests
+const emptyManifestMarker = "# No resources rendered\n"
+
+// hasExpected returns whether given test directory has an expected file or directory
+func hasExpected(testDir string) bool {
+	return fileExists(filepath.Join(testDir, expectedFileName)) || isSplitExpected(testDir)
+}
+
+// isSplitExpected returns whether given test directory has an expected directory
+func isSplitExpected(testDir string) bool {
+	info, err := os.Stat(filepath.Join(testDir, expectedDirName))
+	return err == nil && info.IsDir()
+}
+
+// readExpectedManifest reads the expected manifest of given test directory, from its
+// expected directory if any, or else from its expected file
+func readExpectedManifest(testDir string) (string, error) {
+	if !isSplitExpected(testDir) {
+		data, err := os.ReadFile(filepath.Join(testDir, expectedFileName))
+		if err != nil {
+			return "", fmt.Errorf("reading %s file: %w", expectedFileName, err)
+		}
+		return normalizeSourceHeaders(string(data)), nil
+	}
+
+	dir := filepath.Join(testDir, expectedDirName)
+	main, err := readExpectedFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	hooks, err := readExpectedFiles(filepath.Join(dir, expectedHooksDirName))
+	if err != nil {
+		return "", err
+	}
+	testHooks, err := readExpectedFiles(filepath.Join(dir, expectedTestHooksDirName))
+	if err != nil {
+		return "", err
+	}
+	return normalizeSourceHeaders(joinSections(main, hooks, testHooks)), nil
+}
+
+// readExpectedFiles concatenates the yaml files of given directory, in file name
+// order, ignoring the directory if it does not exist
+func readExpectedFiles(dir string) (string, error) {
+	paths, err := expectedFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	var manifests []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading expected file: %w", err)
+		}
+		manifests = append(manifests, strings.TrimSpace(string(data)))
+	}
+	return strings.Join(manifests, "\n"), nil
+}
+
+// expectedFiles returns the sorted paths of yaml files in given directory, or none
+// if it does not exist
+func expectedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading expected directory: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".yaml" {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// expectedFilePaths returns the paths of all expected files of given test directory,
+// either its expected file or the files of its expected directory
+func expectedFilePaths(testDir string) ([]string, error) {
+	if !isSplitExpected(testDir) {
+		path := filepath.Join(testDir, expectedFileName)
+		if !fileExists(path) {
+			return nil, nil
+		}
+		return []string{path}, nil
+	}
+	dir := filepath.Join(testDir, expectedDirName)
+	paths, err := expectedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	hookPaths, err := expectedFiles(filepath.Join(dir, expectedHooksDirName))
+	if err != nil {
+		return nil, err
+	}
+	testHookPaths, err := expectedFiles(filepath.Join(dir, expectedTestHooksDirName))
+	if err != nil {
+		return nil, err
+	}
+	return append(append(paths, hookPaths...), testHookPaths...), nil
+}
+
+// expectedUpdates returns the updates writing given manifest as expected manifest of
+// given test directory, either to its expected file, or split into one file per
+// resource in its expected directory, removing files of resources no longer rendered
+func expectedUpdates(testDir, manifest string, isSplit bool) ([]fileUpdate, error) {
+	filePath := filepath.Join(testDir, expectedFileName)
+	isEmpty := strings.TrimSpace(manifest) == ""
+	if !isSplit {
+		if isEmpty {
+			manifest = emptyManifestMarker
+		}
+		return []fileUpdate{{path: filePath, content: []byte(manifest)}}, nil
+	}
+
+	var updates []fileUpdate
+	if fileExists(filePath) {
+		updates = append(updates, fileUpdate{path: filePath, isRemoved: true})
+	}
+	dir := filepath.Join(testDir, expectedDirName)
+	main, hooks, testHooks := splitSections(manifest)
+	for _, section := range []struct{ dir, manifest string }{
+		{dir, main},
+		{filepath.Join(dir, expectedHooksDirName), hooks},
+		{filepath.Join(dir, expectedTestHooksDirName), testHooks},
+	} {
+		written := make(map[string]bool)
+		if isEmpty && section.dir == dir {
+			written[emptyExpectedFileName] = true
+			updates = append(updates, fileUpdate{path: filepath.Join(dir, emptyExpectedFileName), content: []byte(emptyManifestMarker)})
+		}
+		for _, document := range splitDocuments(section.manifest) {
+			path := filepath.Join(section.dir, uniqueFileName(resourceFileName(document), written))
+			updates = append(updates, fileUpdate{path: path, content: []byte("---\n" + document + "\n")})
+		}
+
+		// Prune files of resources no longer rendered
+		paths, err := expectedFiles(section.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			if !written[filepath.Base(path)] {
+				updates = append(updates, fileUpdate{path: path, isRemoved: true})
+			}
+		}
+	}
+	return updates, nil
+}
+
+// splitDocuments splits given manifest section into its documents, each starting
+// with its source comment
+func splitDocuments(manifest string) []string {
+	delimiter := "---\n# Source: "
+	var documents []string
+	for _, chunk := range strings.Split(manifest, delimiter) {
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		documents = append(documents, "# Source: "+strings.TrimSpace(chunk))
+	}
+	return documents
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// resourceFileName returns the base name of the expected file of given document,
+// made of its kind and name, or else of its template name
+func resourceFileName(document string) string {
+	parts := strings.SplitN(document, "\n", 2)
+	name := strings.TrimSuffix(filepath.Base(strings.TrimPrefix(parts[0], "# Source: ")), filepath.Ext(parts[0]))
+	if len(parts) == 2 {
+		if identity := resourceIdentity(parts[1]); identity != "" {
+			name = strings.Replace(identity, "/", "-", 1)
+		}
+	}
+	name = strings.Trim(unsafeFileNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+	if name == "" {
+		name = "resource"
+	}
+	return name
+}
+
+// uniqueFileName returns given base name with yaml extension, suffixed with a
+// counter if already in given set of written names, and adds it to that set
+func uniqueFileName(name string, written map[string]bool) string {
+	fileName := name + ".yaml"
+	for i := 2; written[fileName]; i++ {
+		fileName = fmt.Sprintf("%s-%d.yaml", name, i)
+	}
+	written[fileName] = true
+	return fileName
+}
@@ -0,0 +1,41 @@
+package testchart
+
+import (
+	"regexp"
+	"strings"
+)
+
+// expectedErrorFileName is the name of the optional file, in a test directory, making
+// it a negative test that expects rendering to fail with a matching error message
+const expectedErrorFileName = "error.txt"
+
+// checkExpectedError compares given rendering error against given expected error
+// and reports any mismatch to builder, returning whether they match. A nil renderErr
+// means rendering unexpectedly succeeded.
+func checkExpectedError(builder Builder, expected string, renderErr error) bool {
+	expected = strings.TrimSpace(normalizeEncoding(expected))
+	if renderErr == nil {
+		builder.AddDifferentItem(expectedErrorFileName, expected, "")
+		return false
+	}
+	actual := strings.TrimSpace(renderErr.Error())
+	if !matchesExpectedError(actual, expected) {
+		builder.AddDifferentItem(expectedErrorFileName, expected, actual)
+		return false
+	}
+	return true
+}
+
+// matchesExpectedError returns whether given error message matches given expected
+// error, either as a substring or as a regular expression. An empty expected error
+// matches nothing, as it would otherwise match any error.
+func matchesExpectedError(message, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	if strings.Contains(message, expected) {
+		return true
+	}
+	re, err := regexp.Compile(expected)
+	return err == nil && re.MatchString(message)
+}
@@ -0,0 +1,81 @@
+package testchart
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// printGitHubAnnotations prints a GitHub Actions workflow command for each failed
+// test (or test with validation warnings), so that it shows up as an annotation of
+// its expected file in pull requests
+func printGitHubAnnotations(testPath string, results []TestResult) {
+	for _, result := range results {
+		file := filepath.ToSlash(filepath.Join(testPath, result.name, expectedFileName))
+		if !fileExists(file) {
+			file = ""
+		}
+		if !result.isSuccessful() {
+			printGitHubAnnotation("error", file, fmt.Sprintf("testchart: %s failed", result.name), gitHubFailureMessage(result))
+		}
+		if len(result.validationWarnings) > 0 {
+			var lines []string
+			for _, validationWarning := range result.validationWarnings {
+				lines = append(lines, fmt.Sprintf("Invalid %s: %s", validationWarning.signature, validationWarning.error))
+			}
+			printGitHubAnnotation("warning", file, fmt.Sprintf("testchart: %s has invalid resources", result.name), strings.Join(lines, "\n"))
+		}
+	}
+}
+
+// gitHubFailureMessage summarizes why given test failed, followed by the diffs of its
+// different items
+func gitHubFailureMessage(result TestResult) string {
+	var lines []string
+	if result.runError != nil {
+		lines = append(lines, fmt.Sprintf("Error: %v", result.runError))
+	}
+	for _, item := range result.differentItems {
+		if item.path != "" {
+			lines = append(lines, fmt.Sprintf("Different %s at %s", item.source, item.path))
+		} else {
+			lines = append(lines, fmt.Sprintf("Different %s", item.source))
+		}
+	}
+	for _, item := range result.extraItems {
+		lines = append(lines, fmt.Sprintf("Unexpected %s", item.source))
+	}
+	for _, item := range result.missingItems {
+		lines = append(lines, fmt.Sprintf("Missing %s", item.source))
+	}
+	for _, validationError := range result.validationErrors {
+		lines = append(lines, fmt.Sprintf("Invalid %s: %s", validationError.signature, validationError.error))
+	}
+	for _, failedAssertion := range result.failedAssertions {
+		lines = append(lines, fmt.Sprintf("Failed assertion: %s", failedAssertion))
+	}
+	for _, item := range result.differentItems {
+		lines = append(lines, "", strings.TrimRight(item.unifiedDiff(), "\n"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// printGitHubAnnotation prints a GitHub Actions workflow command of given level
+// (error or warning), annotating given file (if any) with given title and message
+func printGitHubAnnotation(level, file, title, message string) {
+	properties := "title=" + escapeGitHubProperty(title)
+	if file != "" {
+		properties = "file=" + escapeGitHubProperty(file) + "," + properties
+	}
+	fmt.Printf("::%s %s::%s\n", level, properties, escapeGitHubData(message))
+}
+
+// escapeGitHubData escapes given workflow command message, which may span lines
+func escapeGitHubData(data string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(data)
+}
+
+// escapeGitHubProperty escapes given workflow command property value
+func escapeGitHubProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
@@ -0,0 +1,92 @@
+package testchart
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+// sampleTestName is the name of the sample test created by init command
+const sampleTestName = "default"
+
+// starterConfig is the content of config file created by init command, documenting
+// the most common settings with their defaults, formatted with release setting
+const starterConfig = `# Configuration of all tests in this directory (all settings are optional)
+
+# Names of release and namespace to use for rendering chart, unless overridden by
+# --release and --namespace flags (default to my-release and my-namespace)
+%s
+# namespace: my-namespace
+
+# Ignores lines matching any of given patterns, unless overridden by --ignore flag
+# ignoreLines:
+#   - "checksum/"
+
+# Excludes hook manifests from comparison, same as --no-hooks flag
+# skipHooks: false
+
+# Sorts given list fields by given key before comparison, for lists rendered in a
+# nondeterministic order (use [*] to traverse all elements of a list)
+# sortLists:
+#   - path: spec.template.spec.containers[*].env
+#     key: name
+
+# Replaces matches of given patterns in both expected and rendered manifests before
+# comparison, masking volatile parts of lines (defaults to <redacted>)
+# substitutions:
+#   - pattern: "checksum/config: ([0-9a-f]+)"
+
+# Skips validation of rendered manifests, same as --no-validate flag
+# skipValidation: false
+
+# Writes expected manifests as one file per resource in an expected/ directory
+# splitExpected: false
+`
+
+// InitTests scaffolds the tests directory with a starter config file, whose release
+// is named after the chart found in current directory, if any, and a sample test
+func InitTests(opts RunOptions, isForced bool) error {
+	configPath := configFilePath(opts)
+	if _, err := os.Stat(configPath); err == nil && !isForced {
+		return fmt.Errorf("%s file already exists (use --force to overwrite)", configPath)
+	}
+	testDir := filepath.Join(opts.TestPath, sampleTestName)
+	if _, err := os.Stat(testDir); err == nil && !isForced {
+		return fmt.Errorf("test directory %q already exists (use --force to overwrite)", testDir)
+	}
+
+	// Detect chart, to name release after it
+	chartName := ""
+	installAction := action.NewInstall(new(action.Configuration))
+	if chartPath, err := locateChart(opts.Chart, cli.New(), installAction); err == nil {
+		if theChart, err := loadChart(chartPath); err == nil {
+			chartName = theChart.Name()
+		}
+	}
+	if chartName == "" {
+		fmt.Println(markers.noChart + ", tests directory is created anyway")
+	}
+
+	if err := os.MkdirAll(opts.TestPath, 0o755); err != nil {
+		return fmt.Errorf("creating tests directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		return fmt.Errorf("creating directory of %s file: %w", filepath.Base(configPath), err)
+	}
+	releaseSetting := "# release: " + defaultRelease
+	if chartName != "" {
+		releaseSetting = "release: " + chartName
+	}
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(starterConfig, releaseSetting)), 0o644); err != nil {
+		return fmt.Errorf("writing %s file: %w", filepath.Base(configPath), err)
+	}
+	if err := NewTest(sampleTestName, opts, isForced, false); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s tests in %q, run `testchart update` to generate expected files\n", markers.initialized, opts.TestPath)
+	return nil
+}
@@ -0,0 +1,48 @@
+package testchart
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// updateDecision is the user's choice when reviewing changes of a test in interactive mode
+type updateDecision int
+
+const (
+	acceptUpdate updateDecision = iota
+	skipUpdate
+	quitUpdate
+)
+
+// errQuitUpdate is returned when the user chooses to quit interactive mode
+var errQuitUpdate = errors.New("update quit by user")
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// promptUpdateDecision asks user whether to accept, skip or quit updating expected
+// files of given test, until a valid answer is given. End of input means quit.
+func promptUpdateDecision(testName string) (updateDecision, error) {
+	for {
+		fmt.Printf("%s Update expected files of %s? [a]ccept / [s]kip / [q]uit: ", markers.prompt, testName)
+		answer, err := stdinReader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return quitUpdate, fmt.Errorf("reading answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "a", "accept":
+			return acceptUpdate, nil
+		case "s", "skip":
+			return skipUpdate, nil
+		case "q", "quit":
+			return quitUpdate, nil
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Println()
+			return quitUpdate, nil
+		}
+	}
+}
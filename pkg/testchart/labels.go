@@ -0,0 +1,70 @@
+package testchart
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resourceLabels holds the identity and labels of a resource
+type resourceLabels struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string            `yaml:"name"`
+		Namespace string            `yaml:"namespace"`
+		Labels    map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+}
+
+// checkRequiredLabels reports resources of given manifest lacking any of configured
+// required labels, or having them with a value other than the required one, which
+// can also be a placeholder (eg: <<ANY>> or <<SEMVER>>)
+func checkRequiredLabels(builder Builder, manifest string, opts RunOptions) {
+	if len(opts.RequiredLabels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(opts.RequiredLabels))
+	for name := range opts.RequiredLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	addValidationError := builder.AddValidationError
+	if opts.ValidationWarnOnly {
+		addValidationError = builder.AddValidationWarning
+	}
+	for _, chunk := range strings.Split(manifest, "---\n# Source: ") {
+		_, content, ok := strings.Cut(strings.TrimSpace(chunk), "\n")
+		if !ok {
+			continue
+		}
+		var resource resourceLabels
+		if err := yaml.Unmarshal([]byte(content), &resource); err != nil || resource.Kind == "" || resource.Metadata.Name == "" {
+			continue
+		}
+		var problems []string
+		for _, name := range names {
+			value, isPresent := resource.Metadata.Labels[name]
+			required := opts.RequiredLabels[name]
+			if !isPresent {
+				problems = append(problems, fmt.Sprintf("missing required label %q", name))
+			} else if !matchesRequiredLabel(value, required) {
+				problems = append(problems, fmt.Sprintf("label %q is %q, expecting %q", name, value, required))
+			}
+		}
+		if len(problems) > 0 {
+			addValidationError(resourceKey(content), strings.Join(problems, "\n"))
+		}
+	}
+}
+
+// matchesRequiredLabel returns whether given label value is accepted by given
+// required value, either literal or containing placeholders
+func matchesRequiredLabel(value, required string) bool {
+	if expression := placeholderLineExpression(required); expression != nil {
+		return expression.MatchString(value)
+	}
+	return value == required
+}
@@ -0,0 +1,49 @@
+package testchart
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ListTests prints the names of tests that would be run with given arguments and
+// options, without rendering chart, along with their values and expected files, so
+// that incomplete test directories stand out
+func ListTests(args []string, opts RunOptions) error {
+	if _, err := os.Stat(opts.TestPath); os.IsNotExist(err) {
+		fmt.Println("No tests found")
+		return nil
+	}
+	testNames, err := resolveTests(args, opts)
+	if err != nil {
+		return err
+	}
+	if len(testNames) == 0 {
+		fmt.Println("No tests found")
+		return nil
+	}
+
+	longestName := 0
+	for _, testName := range testNames {
+		if len(testName) > longestName {
+			longestName = len(testName)
+		}
+	}
+	for _, testName := range testNames {
+		testDir := filepath.Join(opts.TestPath, testName)
+		values := "(no values file)"
+		if hasValuesFile(testDir) {
+			values = filepath.Base(valuesFilePath(testDir))
+		}
+		expected := "(no expected file)"
+		if isSplitExpected(testDir) {
+			expected = expectedDirName + "/"
+		} else if hasExpected(testDir) {
+			expected = expectedFileName
+		} else if fileExists(filepath.Join(testDir, assertionsFileName)) {
+			expected = assertionsFileName
+		}
+		fmt.Printf("%s  %-16s  %s\n", padRight(testName, longestName), values, expected)
+	}
+	return nil
+}
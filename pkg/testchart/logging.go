@@ -0,0 +1,58 @@
+package testchart
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LogLevel is the level of diagnostic messages printed to stderr, as opposed to
+// results printed to stdout
+type LogLevel int
+
+const (
+	LogLevelError LogLevel = iota
+	LogLevelWarn
+	LogLevelInfo
+	LogLevelDebug
+)
+
+// logLevelNames are the names of log levels, as accepted by ParseLogLevel
+var logLevelNames = []string{"error", "warn", "info", "debug"}
+
+// ParseLogLevel returns the log level of given name (eg: "debug")
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return LogLevel(i), nil
+		}
+	}
+	return LogLevelError, fmt.Errorf("unsupported log level %q (expecting one of %s)", name, strings.Join(logLevelNames, ", "))
+}
+
+func (level LogLevel) String() string {
+	if level < 0 || int(level) >= len(logLevelNames) {
+		return fmt.Sprintf("LogLevel(%d)", int(level))
+	}
+	return logLevelNames[level]
+}
+
+// Logf prints given diagnostic message to stderr, prefixed with the marker of its
+// level, unless that level is more verbose than the configured one
+func Logf(level LogLevel, format string, args ...interface{}) {
+	if level > logLevel {
+		return
+	}
+	var marker string
+	switch level {
+	case LogLevelError:
+		marker = markers.logError
+	case LogLevelWarn:
+		marker = markers.logWarn
+	case LogLevelInfo:
+		marker = markers.logInfo
+	default:
+		marker = markers.logDebug
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", marker, fmt.Sprintf(format, args...))
+}
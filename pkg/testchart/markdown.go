@@ -0,0 +1,181 @@
+package testchart
+
+import (
+	"fmt"
+	"strings"
+)
+
+// collapsedLineCount is the number of lines above which content is collapsed in
+// a details block, to keep markdown output readable
+const collapsedLineCount = 20
+
+// MarkdownBuilder renders results as GitHub-flavored markdown, suitable for posting
+// verbatim as a pull request comment. Contrary to PrintBuilder, nothing is printed
+// until all tests have ended.
+type MarkdownBuilder struct {
+	TestResult
+	recordSettings recordSettings
+	isUpdate       bool
+	isDryRun       bool
+	results        []TestResult
+	values         map[string]string
+}
+
+func NewMarkdownBuilder(isUpdate, isDryRun bool) *MarkdownBuilder {
+	return &MarkdownBuilder{isUpdate: isUpdate, isDryRun: isDryRun, values: map[string]string{}, recordSettings: defaultRecordSettings()}
+}
+
+func (mb *MarkdownBuilder) StartAllTests(names []string) {
+	mb.results = nil
+}
+
+func (mb *MarkdownBuilder) StartTest(name string) {
+	mb.TestResult = newTestResult(name, mb.recordSettings)
+}
+
+func (mb *MarkdownBuilder) EndTest() error {
+	if mb.shouldShowValues() {
+		valuesYaml, err := mb.getValuesYaml()
+		if err != nil {
+			return fmt.Errorf("failed to get values yaml: %w", err)
+		}
+		mb.values[mb.name] = valuesYaml
+	}
+	mb.results = append(mb.results, mb.TestResult)
+	return nil
+}
+
+// EndUpdateReview does nothing, as interactive mode is only supported with text output
+func (mb *MarkdownBuilder) EndUpdateReview(isAccepted bool) {
+}
+
+func (mb *MarkdownBuilder) EndAllTests() {
+	var sb strings.Builder
+
+	// Summary
+	fmt.Fprintf(&sb, "## %s Test results\n\n", markers.test)
+	failedCount := 0
+	for _, result := range mb.results {
+		if !result.isSuccessful() {
+			failedCount++
+		}
+	}
+	if len(mb.results) == 0 {
+		sb.WriteString(markers.noTests + "\n")
+	} else if failedCount == 0 {
+		fmt.Fprintf(&sb, "%s %d tests passed\n", markers.allPassed, len(mb.results))
+	} else {
+		fmt.Fprintf(&sb, "%s %d tests failed out of %d\n", markers.someFailed, failedCount, len(mb.results))
+	}
+
+	// Results table
+	if len(mb.results) > 0 {
+		sb.WriteString("\n| Test | Result |\n|------|--------|\n")
+		for _, result := range mb.results {
+			fmt.Fprintf(&sb, "| `%s` | %s |\n", result.name, mb.status(result))
+		}
+	}
+
+	// Details of failed tests
+	for _, result := range mb.results {
+		if result.isSuccessful() && len(result.validationWarnings) == 0 && mb.values[result.name] == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n### %s\n", result.name)
+		if result.runError != nil {
+			writeMarkdownBlock(&sb, markers.runError, "", result.runError.Error())
+		}
+		for _, item := range result.differentItems {
+			title := fmt.Sprintf("%s `%s`", markers.different, item.source)
+			if item.path != "" {
+				title += fmt.Sprintf(" at `%s`", item.path)
+			}
+			writeMarkdownBlock(&sb, title, "diff", item.unifiedDiff())
+		}
+		for _, item := range result.extraItems {
+			writeMarkdownBlock(&sb, fmt.Sprintf("%s `%s`", markers.unexpected, item.source), "yaml", item.actual)
+		}
+		for _, item := range result.missingItems {
+			writeMarkdownBlock(&sb, fmt.Sprintf("%s `%s`", markers.missing, item.source), "yaml", item.expected)
+		}
+		for _, failedAssertion := range result.failedAssertions {
+			fmt.Fprintf(&sb, "\n%s: %s\n", markers.failedAssertion, failedAssertion)
+		}
+		if result.ignoredCount > 0 {
+			fmt.Fprintf(&sb, "\n%s %d resources by kind\n", markers.ignored, result.ignoredCount)
+		}
+		for _, sortedList := range result.sortedLists {
+			fmt.Fprintf(&sb, "\n%s `%s` in `%s`\n", markers.sorted, sortedList.path, sortedList.source)
+		}
+		for _, source := range result.allowedExtras {
+			fmt.Fprintf(&sb, "\n%s `%s`\n", markers.allowedExtra, source)
+		}
+		for _, validationError := range result.validationErrors {
+			writeMarkdownBlock(&sb, fmt.Sprintf("%s `%s`", markers.invalidResource, validationError.signature), "", validationError.error)
+		}
+		for _, validationWarning := range result.validationWarnings {
+			writeMarkdownBlock(&sb, fmt.Sprintf("%s `%s` (warning only)", markers.invalidWarning, validationWarning.signature), "", validationWarning.error)
+		}
+		if valuesYaml := mb.values[result.name]; valuesYaml != "" {
+			writeMarkdownBlock(&sb, markers.values, "yaml", valuesYaml)
+		}
+	}
+
+	fmt.Print(sb.String())
+}
+
+func (mb *MarkdownBuilder) IsSuccessful() bool {
+	for _, result := range mb.results {
+		if !result.isSuccessful() {
+			return false
+		}
+	}
+	return true
+}
+
+func (mb *MarkdownBuilder) Results() []TestResult {
+	return mb.results
+}
+
+func (mb *MarkdownBuilder) status(result TestResult) string {
+	if result.isTimedOut() {
+		return markers.timedOut
+	}
+	if result.runError != nil {
+		return markers.runError
+	}
+	if mb.isUpdate {
+		if result.isSuccessful() {
+			return markers.nothingToUpdate
+		}
+		if !result.isSame && mb.isDryRun {
+			return markers.wouldUpdate
+		}
+		if !result.isSame {
+			return markers.updated
+		}
+	}
+	if result.isSuccessful() {
+		return markers.passed
+	}
+	if !result.isValid {
+		return markers.failed + " " + strings.TrimSpace(markers.invalid)
+	}
+	return markers.failed
+}
+
+// writeMarkdownBlock writes given content as a fenced code block under given title,
+// collapsing it in a details block if it is large
+func writeMarkdownBlock(sb *strings.Builder, title, language, content string) {
+	content = strings.TrimSpace(content)
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	lineCount := strings.Count(content, "\n") + 1
+	if lineCount > collapsedLineCount {
+		fmt.Fprintf(sb, "\n<details>\n<summary>%s (%d lines)</summary>\n\n%s%s\n%s\n%s\n\n</details>\n", title, lineCount, fence, language, content, fence)
+		return
+	}
+	fmt.Fprintf(sb, "\n**%s**\n\n%s%s\n%s\n%s\n", title, fence, language, content, fence)
+}
@@ -0,0 +1,124 @@
+package testchart
+
+// markerSet holds the status markers and separators printed in text and markdown
+// output
+type markerSet struct {
+	test, runError, nothingToUpdate, passed, review, updated, failed, invalid                                               string
+	different, redactedOnly, unexpected, missing, pruned, wouldPrune, wouldUpdate, sorted, invalidResource, failedAssertion string
+	invalidWarning, values, skippedUpdate, skippedUpdates, changedSources, slowest, timedOut                                string
+	noTests, noResources, allPassed, someFailed, separator3                                                                 string
+	logError, logWarn, logInfo, logDebug, allowedExtra, coverage, neverRendered, normalized                                 string
+	checkFailed, checkPassed, doctor, noProblems, problems, noChart, initialized, created                                   string
+	prompt, schemaMismatch, generated, watching, ignored                                                                    string
+}
+
+var emojiMarkers = markerSet{
+	test:            "🧪",
+	runError:        "💥 Error",
+	nothingToUpdate: "👍 Nothing to update in expected file",
+	passed:          "✅  Passed",
+	review:          "🧐 Review changes to expected file",
+	updated:         "📝 Updated expected file",
+	failed:          "💔 Failed",
+	invalid:         "👮 Invalid",
+	different:       "🥸 Different",
+	redactedOnly:    "🔒 Only redacted values differ",
+	unexpected:      "🤡 Unexpected",
+	missing:         "🫥️ Missing",
+	pruned:          "🧹 Pruned",
+	wouldPrune:      "🧹 Would prune",
+	wouldUpdate:     "🔎 Would update expected files",
+	sorted:          "🔀 Sorted",
+	failedAssertion: "❌ Failed assertion",
+	invalidResource: "🚨 Invalid",
+	invalidWarning:  "⚠️ Invalid",
+	values:          "📜 Coalesced values",
+	skippedUpdate:   "⏭️ Skipped update of expected file",
+	skippedUpdates:  "⏭️ Skipped updating",
+	changedSources:  "📂 Changed sources",
+	slowest:         "🐢 Slowest tests",
+	timedOut:        "⏱️ Timed out",
+	noTests:         "🤷 No tests were run",
+	noResources:     "🕳️ No resources rendered",
+	allPassed:       "🌈🦄⭐️  All",
+	someFailed:      "🔥👺🧨 ",
+	separator3:      "———————",
+	logError:        "💥",
+	logWarn:         "⚠️",
+	logInfo:         "ℹ️",
+	logDebug:        "🔍",
+	allowedExtra:    "🆗 Allowed extra",
+	coverage:        "📊 Template coverage",
+	neverRendered:   "🙈 Never rendered",
+	normalized:      "🧹 Normalized",
+	checkFailed:     "❌",
+	checkPassed:     "✅",
+	doctor:          "🩺",
+	noProblems:      "🌈 No problems found",
+	problems:        "🩹",
+	noChart:         "⚠️ No chart found",
+	initialized:     "🐣 Initialized",
+	created:         "🐣 Created",
+	prompt:          "❓",
+	schemaMismatch:  "⚠️ Generated schema does not validate all test values",
+	generated:       "📐 Generated",
+	watching:        "👀 Watching for changes",
+	ignored:         "🙈 Ignored",
+}
+
+var asciiMarkers = markerSet{
+	test:            "[TEST]",
+	runError:        "[ERROR]",
+	nothingToUpdate: "[PASS] Nothing to update in expected file",
+	passed:          "[PASS]",
+	review:          "[REVIEW] Review changes to expected file",
+	updated:         "[UPDATED] Updated expected file",
+	failed:          "[FAIL]",
+	invalid:         " [INVALID]",
+	different:       "[DIFF]",
+	redactedOnly:    "[REDACTED] Only redacted values differ",
+	unexpected:      "[EXTRA]",
+	missing:         "[MISSING]",
+	pruned:          "[PRUNED]",
+	wouldPrune:      "[PRUNE]",
+	wouldUpdate:     "[WOULD UPDATE] Would update expected files",
+	sorted:          "[SORTED]",
+	failedAssertion: "[ASSERT] Failed assertion",
+	invalidResource: "[INVALID]",
+	invalidWarning:  "[WARNING] Invalid",
+	values:          "[VALUES] Coalesced values",
+	skippedUpdate:   "[SKIPPED] Skipped update of expected file",
+	skippedUpdates:  "[SKIPPED] Skipped updating",
+	changedSources:  "[CHANGED] Changed sources",
+	slowest:         "[SLOW] Slowest tests",
+	timedOut:        "[TIMEOUT] Timed out",
+	noTests:         "[NONE] No tests were run",
+	noResources:     "[EMPTY] No resources rendered",
+	allPassed:       "[PASS] All",
+	someFailed:      "[FAIL]",
+	separator3:      "-------",
+	logError:        "[ERROR]",
+	logWarn:         "[WARNING]",
+	logInfo:         "[INFO]",
+	logDebug:        "[DEBUG]",
+	allowedExtra:    "[ALLOWED] Allowed extra",
+	coverage:        "[COVERAGE] Template coverage",
+	neverRendered:   "[UNCOVERED] Never rendered",
+	normalized:      "[NORMALIZED] Normalized",
+	checkFailed:     "[FAIL]",
+	checkPassed:     "[PASS]",
+	doctor:          "[DOCTOR]",
+	noProblems:      "[PASS] No problems found",
+	problems:        "[FAIL]",
+	noChart:         "[WARNING] No chart found",
+	initialized:     "[INIT] Initialized",
+	created:         "[NEW] Created",
+	prompt:          "[PROMPT]",
+	schemaMismatch:  "[WARNING] Generated schema does not validate all test values",
+	generated:       "[GENERATED] Generated",
+	watching:        "[WATCH] Watching for changes",
+	ignored:         "[IGNORED] Ignored",
+}
+
+// markers are the markers currently used in text output
+var markers = emojiMarkers
@@ -0,0 +1,73 @@
+package testchart
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+// starterValues is the content of values file of new tests not seeded from chart
+const starterValues = "# Values overriding chart defaults for this test\n"
+
+// NewTest scaffolds a test directory with given name, containing a starter values
+// file (optionally seeded from chart's default values) and an empty expected file
+// (or directory, if configured to split expected manifests). When forced, an existing
+// test directory is cleared first, so that no stale files are left behind.
+func NewTest(name string, opts RunOptions, isForced, isSeeded bool) error {
+	testDir := filepath.Join(opts.TestPath, name)
+	if relativePath, err := filepath.Rel(opts.TestPath, testDir); err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+		return fmt.Errorf("invalid test name %q", name)
+	}
+	_, err := os.Stat(testDir)
+	isExisting := err == nil
+	if isExisting && !isForced {
+		return fmt.Errorf("test directory %q already exists (use --force to overwrite)", testDir)
+	}
+
+	values := []byte(starterValues)
+	if isSeeded {
+		installAction := action.NewInstall(new(action.Configuration))
+		chartPath, err := locateChart(opts.Chart, cli.New(), installAction)
+		if err != nil {
+			return fmt.Errorf("locating chart: %w", err)
+		}
+		theChart, err := loadChart(chartPath)
+		if err != nil {
+			return fmt.Errorf("loading chart: %w", err)
+		}
+		for _, file := range theChart.Raw {
+			if file.Name == valuesFileName {
+				values = file.Data
+			}
+		}
+	}
+
+	if isExisting {
+		if err := os.RemoveAll(testDir); err != nil {
+			return fmt.Errorf("clearing test directory: %w", err)
+		}
+	}
+	if err := os.MkdirAll(testDir, 0o755); err != nil {
+		return fmt.Errorf("creating test directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, valuesFileName), values, 0o644); err != nil {
+		return fmt.Errorf("writing %s file: %w", valuesFileName, err)
+	}
+	config, err := loadConfig(opts)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if config.SplitExpected {
+		if err := os.MkdirAll(filepath.Join(testDir, expectedDirName), 0o755); err != nil {
+			return fmt.Errorf("creating %s directory: %w", expectedDirName, err)
+		}
+	} else if err := os.WriteFile(filepath.Join(testDir, expectedFileName), nil, 0o644); err != nil {
+		return fmt.Errorf("writing %s file: %w", expectedFileName, err)
+	}
+	fmt.Printf("%s test %q\n", markers.created, name)
+	return nil
+}
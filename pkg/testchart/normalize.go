@@ -0,0 +1,520 @@
+package testchart
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// ListSort specifies a list field to sort by given key before comparison
+// (eg: path "spec.template.spec.containers[*].env" and key "name")
+type ListSort struct {
+	Path string `yaml:"path"`
+	Key  string `yaml:"key"`
+}
+
+// Substitution specifies a pattern whose matches are replaced by given replacement
+// in both expected and actual manifests before comparison, so that volatile parts
+// of a line can be masked while keeping the rest of it comparable. If pattern has
+// capture groups, only the captured substrings are replaced.
+type Substitution struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
+
+// defaultSubstitutionReplacement is the replacement used by substitutions that do
+// not specify one
+const defaultSubstitutionReplacement = "<redacted>"
+
+type compiledSubstitution struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// compileSubstitutions compiles the patterns of given substitutions
+func compileSubstitutions(substitutions []Substitution) ([]compiledSubstitution, error) {
+	var compiled []compiledSubstitution
+	for _, substitution := range substitutions {
+		pattern, err := regexp.Compile(substitution.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile substitution pattern %q: %v", substitution.Pattern, err)
+		}
+		replacement := substitution.Replacement
+		if replacement == "" {
+			replacement = defaultSubstitutionReplacement
+		}
+		compiled = append(compiled, compiledSubstitution{pattern: pattern, replacement: replacement})
+	}
+	return compiled, nil
+}
+
+// applySubstitutions replaces the matches of given substitutions in input, or only
+// their captured substrings for patterns with capture groups
+func applySubstitutions(input string, substitutions []compiledSubstitution) string {
+	for _, substitution := range substitutions {
+		if substitution.pattern.NumSubexp() == 0 {
+			input = substitution.pattern.ReplaceAllLiteralString(input, substitution.replacement)
+			continue
+		}
+
+		var sb strings.Builder
+		last := 0
+		for _, match := range substitution.pattern.FindAllStringSubmatchIndex(input, -1) {
+			for group := 1; group*2 < len(match); group++ {
+				start, end := match[group*2], match[group*2+1]
+				if start < last {
+					// Skip unmatched and nested groups
+					continue
+				}
+				sb.WriteString(input[last:start])
+				sb.WriteString(substitution.replacement)
+				last = end
+			}
+		}
+		sb.WriteString(input[last:])
+		input = sb.String()
+	}
+	return input
+}
+
+// versionLabelSubstitutions returns the substitutions normalizing the standard chart
+// and app version labels of resources (helm.sh/chart and app.kubernetes.io/version)
+// to the versions of given chart, so that expected files pinned to other versions
+// still match
+func versionLabelSubstitutions(metadata *chart.Metadata) []compiledSubstitution {
+	substitutions := []compiledSubstitution{{
+		pattern:     regexp.MustCompile(`(?m)^\s*helm\.sh/chart:\s*"?` + regexp.QuoteMeta(metadata.Name) + `-([^"\s]+)"?\s*$`),
+		replacement: strings.ReplaceAll(metadata.Version, "+", "_"),
+	}}
+	if metadata.AppVersion != "" {
+		substitutions = append(substitutions, compiledSubstitution{
+			pattern:     regexp.MustCompile(`(?m)^\s*app\.kubernetes\.io/version:\s*"?([^"\s]+)"?\s*$`),
+			replacement: metadata.AppVersion,
+		})
+	}
+	return substitutions
+}
+
+// normalizeEncoding removes invisible encoding differences from given manifest, by
+// stripping byte order marks, normalizing unicode to NFC, converting CRLF line
+// endings to LF and ending it with exactly one newline
+func normalizeEncoding(manifest string) string {
+	manifest = strings.ReplaceAll(manifest, "\uFEFF", "")
+	manifest = norm.NFC.String(manifest)
+	manifest = strings.ReplaceAll(manifest, "\r\n", "\n")
+	return strings.TrimRight(manifest, "\n") + "\n"
+}
+
+// sourceHeaderPattern matches the source comments of documents, tolerating whitespace
+// variations (eg: "#Source:x" or "#  Source :  x")
+var sourceHeaderPattern = regexp.MustCompile(`(?m)^#[ \t]*Source[ \t]*:[ \t]*(.*?)[ \t]*$`)
+
+// documentDelimiterPattern matches document delimiters followed by whitespace
+var documentDelimiterPattern = regexp.MustCompile(`(?m)^---[ \t]+$`)
+
+// undelimitedHeaderPattern matches the source comment of the first document of a
+// manifest or of its hook sections, when not preceded by a document delimiter
+var undelimitedHeaderPattern = regexp.MustCompile(`(?m)(\A|^` + regexp.QuoteMeta(hooksMarker) + `\n|^` + regexp.QuoteMeta(testHooksMarker) + `\n)((?:[ \t]*\n)*)# Source: `)
+
+// normalizeSourceHeaders rewrites the document delimiters and source comments of given
+// manifest in the exact form used to split it into documents ("---\n# Source: "),
+// so that hand-written manifests with whitespace variations or without a delimiter
+// before their first document are split the same way as rendered ones
+func normalizeSourceHeaders(manifest string) string {
+	manifest = sourceHeaderPattern.ReplaceAllString(manifest, "# Source: $1")
+	manifest = documentDelimiterPattern.ReplaceAllString(manifest, "---")
+	return undelimitedHeaderPattern.ReplaceAllString(manifest, "$1$2---\n# Source: ")
+}
+
+// canonicalManifest returns given manifest with encoding normalized and its
+// documents consistently delimited, without altering their content
+func canonicalManifest(manifest string) string {
+	main, hooks, testHooks := splitSections(normalizeSourceHeaders(normalizeEncoding(manifest)))
+	return joinSections(canonicalDocuments(main), canonicalDocuments(hooks), canonicalDocuments(testHooks))
+}
+
+// canonicalDocuments re-joins the documents of given manifest section, trimming
+// whitespace around them, unless section does not start with a document delimiter
+func canonicalDocuments(section string) string {
+	if !strings.HasPrefix(strings.TrimLeft(section, "\n"), "---\n# Source: ") {
+		return section
+	}
+	var documents []string
+	for _, document := range splitDocuments(section) {
+		documents = append(documents, "---\n"+document)
+	}
+	return strings.Join(documents, "\n")
+}
+
+// hasNonCanonicalExpectedFiles returns whether any expected file of given test
+// directory is not in canonical form (eg: CRLF line endings or source comment
+// variants), as read files are normalized before comparison
+func hasNonCanonicalExpectedFiles(testDir string) (bool, error) {
+	paths, err := expectedFilePaths(testDir)
+	if err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false, fmt.Errorf("reading expected file: %w", err)
+		}
+		if canonicalManifest(string(data)) != string(data) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NormalizeExpectedFiles rewrites the expected files of given tests (or all tests if
+// none given) in canonical form, without rendering chart, and returns the number of
+// files that were reformatted
+func NormalizeExpectedFiles(opts RunOptions, args []string) (int, error) {
+	testNames, err := selectTests(opts.TestPath, args)
+	if err != nil {
+		return 0, err
+	}
+	testNames, err = filterTestsByTags(opts.TestPath, testNames, opts.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, testName := range testNames {
+		paths, err := expectedFilePaths(filepath.Join(opts.TestPath, testName))
+		if err != nil {
+			return count, err
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return count, fmt.Errorf("reading expected file: %w", err)
+			}
+			normalized := canonicalManifest(string(data))
+			if normalized == string(data) {
+				continue
+			}
+			if err := os.WriteFile(path, []byte(normalized), 0o644); err != nil {
+				return count, fmt.Errorf("writing normalized %s file: %w", filepath.Base(path), err)
+			}
+			fmt.Printf("%s %q\n", markers.normalized, path)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// convertKindsToJSON converts the documents of given manifest whose kind is one of
+// given kinds to canonical JSON, with sorted keys and 2-space indentation, leaving
+// other documents untouched
+func convertKindsToJSON(manifest string, kinds []string) string {
+	if len(kinds) == 0 {
+		return manifest
+	}
+	main, hooks, testHooks := splitSections(manifest)
+	return joinSections(convertSectionKindsToJSON(main, kinds), convertSectionKindsToJSON(hooks, kinds), convertSectionKindsToJSON(testHooks, kinds))
+}
+
+func convertSectionKindsToJSON(section string, kinds []string) string {
+	if !strings.HasPrefix(strings.TrimLeft(section, "\n"), "---\n# Source: ") {
+		return section
+	}
+	var documents []string
+	for _, document := range splitDocuments(section) {
+		parts := strings.SplitN(document, "\n", 2)
+		if len(parts) == 2 {
+			if converted, ok := canonicalJSON(parts[1], kinds); ok {
+				document = parts[0] + "\n" + converted
+			}
+		}
+		documents = append(documents, "---\n"+document)
+	}
+	return strings.Join(documents, "\n")
+}
+
+// hasNonCanonicalJSONKinds returns whether given manifest has documents of given
+// kinds not already in canonical JSON form
+func hasNonCanonicalJSONKinds(manifest string, kinds []string) bool {
+	main, hooks, testHooks := splitSections(manifest)
+	for _, section := range []string{main, hooks, testHooks} {
+		for _, document := range splitDocuments(section) {
+			parts := strings.SplitN(document, "\n", 2)
+			if len(parts) < 2 {
+				continue
+			}
+			if converted, ok := canonicalJSON(parts[1], kinds); ok && converted != strings.TrimSpace(parts[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canonicalJSON returns given resource content as canonical JSON, if its kind is one
+// of given kinds
+func canonicalJSON(content string, kinds []string) (string, bool) {
+	doc, err := unmarshalMapSlice([]byte(content))
+	if err != nil || !contains(kinds, kindOf(doc)) {
+		return content, false
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(jsonCompatible(doc)); err != nil {
+		return content, false
+	}
+	return strings.TrimSpace(buffer.String()), true
+}
+
+// jsonCompatible converts ordered maps of given yaml tree to maps with string keys,
+// which get sorted when encoded as JSON
+func jsonCompatible(node interface{}) interface{} {
+	switch v := node.(type) {
+	case mapSlice:
+		newNode := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			newNode[fmt.Sprint(item.Key)] = jsonCompatible(item.Value)
+		}
+		return newNode
+	case []interface{}:
+		newNode := make([]interface{}, len(v))
+		for i, elem := range v {
+			newNode[i] = jsonCompatible(elem)
+		}
+		return newNode
+	default:
+		return v
+	}
+}
+
+// normalizeItems applies configured normalizations to the content of each item
+// before comparison, reporting changes to builder only if report is true
+func normalizeItems(builder Builder, items map[string]string, opts RunOptions, report bool) {
+	for _, source := range sortedKeys(items) {
+		content := items[source]
+		if len(opts.SortLists) > 0 {
+			sorted, changedPaths := sortListFields(content, opts.SortLists)
+			if report {
+				for _, path := range changedPaths {
+					builder.AddSortedList(source, path)
+				}
+			}
+			content = sorted
+		}
+		if opts.SortRBACRules {
+			sorted, isChanged := sortRBACRules(content)
+			if report && isChanged {
+				builder.AddSortedList(source, "rules")
+			}
+			content = sorted
+		}
+		if opts.StripStatus {
+			content = stripStatusFields(content)
+		}
+		items[source] = content
+	}
+}
+
+// sortListFields sorts the list fields of given resource content that match given
+// sorts, returning the re-serialized content along with the paths of lists whose
+// ordering changed. Content is returned untouched if no list field matched.
+func sortListFields(content string, sorts []ListSort) (string, []string) {
+	doc, err := unmarshalMapSlice([]byte(content))
+	if err != nil {
+		return content, nil
+	}
+
+	matched := false
+	var changedPaths []string
+	for _, listSort := range sorts {
+		walkPath(doc, strings.Split(listSort.Path, "."), "", func(path string, list []interface{}) {
+			matched = true
+			if sortList(list, listSort.Key) {
+				changedPaths = append(changedPaths, path)
+			}
+		})
+	}
+	if !matched {
+		return content, nil
+	}
+
+	data, err := marshalYAML(doc)
+	if err != nil {
+		return content, nil
+	}
+	return strings.TrimSpace(string(data)), changedPaths
+}
+
+// rbacRuleKeyFields are the fields of RBAC rules making up their canonical sort key
+var rbacRuleKeyFields = []string{"apiGroups", "resources", "resourceNames", "nonResourceURLs", "verbs"}
+
+// sortRBACRules sorts the rules of given resource content by a canonical key made of
+// their api groups, resources and verbs, if it is a Role or ClusterRole, returning
+// the re-serialized content along with whether ordering changed. Content is returned
+// untouched if it has no rules.
+func sortRBACRules(content string) (string, bool) {
+	doc, err := unmarshalMapSlice([]byte(content))
+	if err != nil {
+		return content, false
+	}
+	if kind := kindOf(doc); kind != "Role" && kind != "ClusterRole" {
+		return content, false
+	}
+
+	for _, item := range doc {
+		rules, ok := item.Value.([]interface{})
+		if item.Key != "rules" || !ok {
+			continue
+		}
+		keyOf := func(rule interface{}) string {
+			mapSlice, _ := rule.(mapSlice)
+			var parts []string
+			for _, field := range rbacRuleKeyFields {
+				var values []string
+				for _, ruleItem := range mapSlice {
+					if list, ok := ruleItem.Value.([]interface{}); ok && ruleItem.Key == field {
+						for _, value := range list {
+							values = append(values, fmt.Sprint(value))
+						}
+					}
+				}
+				parts = append(parts, strings.Join(values, ","))
+			}
+			return strings.Join(parts, "\x00")
+		}
+		less := func(i, j int) bool {
+			return keyOf(rules[i]) < keyOf(rules[j])
+		}
+		isChanged := !sort.SliceIsSorted(rules, less)
+		sort.SliceStable(rules, less)
+
+		data, err := marshalYAML(doc)
+		if err != nil {
+			return content, false
+		}
+		return strings.TrimSpace(string(data)), isChanged
+	}
+	return content, false
+}
+
+// stripStatusFields removes fields of given resource content that are populated by
+// the server rather than declared, namely status, metadata.generation and null
+// metadata.creationTimestamp. Content is always re-serialized, so that it formats the
+// same whether or not it had any of those fields.
+func stripStatusFields(content string) string {
+	doc, err := unmarshalMapSlice([]byte(content))
+	if err != nil {
+		return content
+	}
+
+	var stripped mapSlice
+	for _, item := range doc {
+		switch {
+		case item.Key == "status":
+			continue
+		case item.Key == "metadata":
+			if metadata, ok := item.Value.(mapSlice); ok {
+				var strippedMetadata mapSlice
+				for _, metadataItem := range metadata {
+					if metadataItem.Key == "generation" || (metadataItem.Key == "creationTimestamp" && metadataItem.Value == nil) {
+						continue
+					}
+					strippedMetadata = append(strippedMetadata, metadataItem)
+				}
+				item.Value = strippedMetadata
+			}
+		}
+		stripped = append(stripped, item)
+	}
+	data, err := marshalYAML(stripped)
+	if err != nil {
+		return content
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// kindOf returns the kind of given resource document
+func kindOf(doc mapSlice) string {
+	for _, item := range doc {
+		if item.Key == "kind" {
+			return fmt.Sprint(item.Value)
+		}
+	}
+	return ""
+}
+
+// walkPath calls fn for each list found at given path segments under node, where
+// a segment suffixed with "[*]" iterates over all elements of a list
+func walkPath(node interface{}, segments []string, parentPath string, fn func(path string, list []interface{})) {
+	mapSlice, ok := node.(mapSlice)
+	if !ok || len(segments) == 0 {
+		return
+	}
+
+	name := strings.TrimSuffix(segments[0], "[*]")
+	isWildcard := name != segments[0]
+	path := name
+	if parentPath != "" {
+		path = parentPath + "." + name
+	}
+
+	for _, item := range mapSlice {
+		if item.Key != name {
+			continue
+		}
+		if !isWildcard && len(segments) > 1 {
+			walkPath(item.Value, segments[1:], path, fn)
+			return
+		}
+		list, ok := item.Value.([]interface{})
+		if !ok {
+			return
+		}
+		if len(segments) == 1 {
+			if !isWildcard {
+				fn(path, list)
+			}
+			return
+		}
+		for i, elem := range list {
+			walkPath(elem, segments[1:], fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+		return
+	}
+}
+
+// sortList sorts given list of maps in place by the value of given key, returning
+// whether ordering changed
+func sortList(list []interface{}, key string) bool {
+	keyOf := func(elem interface{}) string {
+		if mapSlice, ok := elem.(mapSlice); ok {
+			for _, item := range mapSlice {
+				if item.Key == key {
+					return fmt.Sprint(item.Value)
+				}
+			}
+		}
+		return ""
+	}
+
+	isSorted := sort.SliceIsSorted(list, func(i, j int) bool {
+		return keyOf(list[i]) < keyOf(list[j])
+	})
+	if isSorted {
+		return false
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return keyOf(list[i]) < keyOf(list[j])
+	})
+	return true
+}
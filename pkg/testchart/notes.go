@@ -0,0 +1,44 @@
+package testchart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expectedNotesFileName is the name of the optional file, in a test directory,
+// holding the NOTES.txt content expected to be rendered for that test
+const expectedNotesFileName = "expected-notes.txt"
+
+// compareNotes compares given rendered notes against expected notes of given test
+// directory, only if expected for that test (or to create them on update), reporting
+// any difference to builder. Returns whether they are equal, along with the content
+// of expected notes file to write on update.
+func compareNotes(builder Builder, testDir, actualNotes string, isUpdate bool) (bool, string, error) {
+	actualNotes = strings.TrimSpace(normalizeEncoding(actualNotes))
+	actualNotesText := ""
+	if actualNotes != "" {
+		actualNotesText = actualNotes + "\n"
+	}
+
+	expectedNotesBytes, err := os.ReadFile(filepath.Join(testDir, expectedNotesFileName))
+	if err == nil {
+		expectedNotes := strings.TrimSpace(normalizeEncoding(string(expectedNotesBytes)))
+		if expectedNotes != actualNotes {
+			builder.AddDifferentItem(expectedNotesFileName, expectedNotes, actualNotes)
+			return false, actualNotesText, nil
+		}
+		return true, actualNotesText, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return false, "", fmt.Errorf("reading %s file: %w", expectedNotesFileName, err)
+	}
+	if isUpdate && actualNotes != "" {
+		// Report notes file to be created like any other item
+		builder.AddExtraItem(expectedNotesFileName, actualNotes)
+		return false, actualNotesText, nil
+	}
+	return true, actualNotesText, nil
+}
@@ -0,0 +1,50 @@
+package testchart
+
+// OutputOptions holds the settings of output, which apply to all commands
+type OutputOptions struct {
+	Format        string
+	Quiet         bool
+	NoColor       bool
+	ASCII         bool
+	Redact        bool
+	SaveActual    bool
+	KeepActual    bool
+	ShowValues    bool
+	ShowAllValues bool
+	Slowest       int
+	DiffContext   int
+	DebugOutput   string
+	GitHub        bool
+	SummaryTable  bool
+	NoDurations   bool
+	LogLevel      LogLevel
+}
+
+// DefaultOutputOptions returns the output options used when none are set
+func DefaultOutputOptions() OutputOptions {
+	return OutputOptions{Format: "text", DiffContext: DefaultDiffContext, LogLevel: LogLevelWarn}
+}
+
+// SetOutputOptions sets the output options of all subsequent commands
+func SetOutputOptions(options OutputOptions) {
+	outputFormat = options.Format
+	quiet = options.Quiet
+	noColor = options.NoColor
+	redact = options.Redact
+	saveActual = options.SaveActual
+	keepActual = options.KeepActual
+	showValues = options.ShowValues
+	showAllValues = options.ShowAllValues
+	slowest = options.Slowest
+	diffContext = options.DiffContext
+	debugOutput = options.DebugOutput
+	githubAnnotations = options.GitHub
+	summaryTable = options.SummaryTable
+	noDurations = options.NoDurations
+	logLevel = options.LogLevel
+	ascii = options.ASCII
+	markers = emojiMarkers
+	if ascii {
+		markers = asciiMarkers
+	}
+}
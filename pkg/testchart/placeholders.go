@@ -0,0 +1,89 @@
+package testchart
+
+import (
+	"regexp"
+	"strings"
+)
+
+// placeholderPatterns are the regular expressions matched by each placeholder that
+// expected files can contain, in the form <<NAME>>, to accept volatile values
+var placeholderPatterns = map[string]string{
+	"ANY":    `.*`,
+	"SEMVER": `v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?`,
+	"UUID":   `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"DATE":   `[0-9]{4}-[0-9]{2}-[0-9]{2}([T ][0-9]{2}:[0-9]{2}(:[0-9]{2}(\.[0-9]+)?)?(Z|[+-][0-9]{2}:?[0-9]{2})?)?`,
+}
+
+// placeholderPattern matches the placeholders of expected files
+var placeholderPattern = regexp.MustCompile(`<<(ANY|SEMVER|UUID|DATE)>>`)
+
+// placeholderLineExpression returns the regular expression matching the actual lines
+// accepted by given expected line, or nil if it has no placeholders
+func placeholderLineExpression(line string) *regexp.Regexp {
+	indices := placeholderPattern.FindAllStringSubmatchIndex(line, -1)
+	if len(indices) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	last := 0
+	for _, index := range indices {
+		sb.WriteString(regexp.QuoteMeta(line[last:index[0]]))
+		sb.WriteString("(?:" + placeholderPatterns[line[index[2]:index[3]]] + ")")
+		last = index[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(line[last:]))
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// alignPlaceholders returns the index of the actual line matched by each expected line
+// having placeholders, aligning both in order, where other expected lines equal to an
+// actual line serve as anchors
+func alignPlaceholders(expectedLines, actualLines []string) map[int]int {
+	matches := make(map[int]int)
+	cursor := 0
+	for i, line := range expectedLines {
+		expression := placeholderLineExpression(line)
+		for j := cursor; j < len(actualLines); j++ {
+			if (expression != nil && expression.MatchString(actualLines[j])) || (expression == nil && line == actualLines[j]) {
+				if expression != nil {
+					matches[i] = j
+				}
+				cursor = j + 1
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// resolvePlaceholders returns given expected content with each line having
+// placeholders replaced by the actual line it matches, if any, so that volatile
+// values accepted by placeholders do not count as differences
+func resolvePlaceholders(expected, actual string) string {
+	if !placeholderPattern.MatchString(expected) {
+		return expected
+	}
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+	for i, j := range alignPlaceholders(expectedLines, actualLines) {
+		expectedLines[i] = actualLines[j]
+	}
+	return strings.Join(expectedLines, "\n")
+}
+
+// restorePlaceholders returns given actual content with each line matched by an
+// expected line having placeholders replaced by that expected line, so that updating
+// expected files preserves their placeholders
+func restorePlaceholders(expected, actual string) string {
+	if !placeholderPattern.MatchString(expected) {
+		return actual
+	}
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+	for i, j := range alignPlaceholders(expectedLines, actualLines) {
+		actualLines[j] = expectedLines[i]
+	}
+	return strings.Join(actualLines, "\n")
+}
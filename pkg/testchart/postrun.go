@@ -0,0 +1,95 @@
+package testchart
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+)
+
+// Results is the structured representation of the results of all tests, as returned
+// by Run and passed as JSON to post-run command
+type Results struct {
+	IsSuccessful bool          `json:"successful"`
+	Tests        []TestOutcome `json:"tests"`
+}
+
+// TestOutcome is the structured representation of the results of a single test
+type TestOutcome struct {
+	Name               string          `json:"name"`
+	IsSuccessful       bool            `json:"successful"`
+	IsSame             bool            `json:"same"`
+	IsValid            bool            `json:"valid"`
+	Error              string          `json:"error,omitempty"`
+	DifferentItems     []ItemDiff      `json:"different,omitempty"`
+	MissingItems       []string        `json:"missing,omitempty"`
+	ExtraItems         []string        `json:"extra,omitempty"`
+	ValidationErrors   []ResourceError `json:"validationErrors,omitempty"`
+	ValidationWarnings []ResourceError `json:"validationWarnings,omitempty"`
+	FailedAssertions   []string        `json:"failedAssertions,omitempty"`
+}
+
+// ItemDiff is the unified diff of a resource differing from its expected manifest
+type ItemDiff struct {
+	Source string `json:"source"`
+	Path   string `json:"path,omitempty"`
+	Diff   string `json:"diff"`
+}
+
+// ResourceError is the validation error of a resource, identified by its signature
+type ResourceError struct {
+	Signature string `json:"signature"`
+	Error     string `json:"error"`
+}
+
+func newResults(results []TestResult) Results {
+	jr := Results{IsSuccessful: true, Tests: []TestOutcome{}}
+	for _, result := range results {
+		test := TestOutcome{
+			Name:         result.name,
+			IsSuccessful: result.isSuccessful(),
+			IsSame:       result.isSame,
+			IsValid:      result.isValid,
+		}
+		if result.runError != nil {
+			test.Error = result.runError.Error()
+		}
+		for _, item := range result.differentItems {
+			test.DifferentItems = append(test.DifferentItems, ItemDiff{item.source, item.path, item.unifiedDiff()})
+		}
+		for _, item := range result.missingItems {
+			test.MissingItems = append(test.MissingItems, item.source)
+		}
+		for _, item := range result.extraItems {
+			test.ExtraItems = append(test.ExtraItems, item.source)
+		}
+		for _, validationError := range result.validationErrors {
+			test.ValidationErrors = append(test.ValidationErrors, ResourceError{validationError.signature, validationError.error})
+		}
+		for _, validationWarning := range result.validationWarnings {
+			test.ValidationWarnings = append(test.ValidationWarnings, ResourceError{validationWarning.signature, validationWarning.error})
+		}
+		test.FailedAssertions = result.failedAssertions
+		jr.IsSuccessful = jr.IsSuccessful && test.IsSuccessful
+		jr.Tests = append(jr.Tests, test)
+	}
+	return jr
+}
+
+// runPostRunCommand executes given shell command with given results as JSON on its
+// stdin. Failures are only reported, as they must not affect tests outcome.
+func runPostRunCommand(command string, results []TestResult) {
+	data, err := json.MarshalIndent(newResults(results), "", "  ")
+	if err != nil {
+		Logf(LogLevelWarn, "Serializing results for post-run command: %v", err)
+		return
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		Logf(LogLevelWarn, "Post-run command failed: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package testchart
+
+// ResultsBuilder collects the results of all tests without printing anything, for
+// inspecting them programmatically (eg: from a go test)
+type ResultsBuilder struct {
+	TestResult
+	recordSettings recordSettings
+	results        []TestResult
+}
+
+func NewResultsBuilder() *ResultsBuilder {
+	return &ResultsBuilder{recordSettings: defaultRecordSettings()}
+}
+
+func (rb *ResultsBuilder) StartAllTests(names []string) {
+	rb.results = nil
+}
+
+func (rb *ResultsBuilder) StartTest(name string) {
+	rb.TestResult = newTestResult(name, rb.recordSettings)
+}
+
+func (rb *ResultsBuilder) EndTest() error {
+	rb.results = append(rb.results, rb.TestResult)
+	return nil
+}
+
+// EndUpdateReview does nothing, as interactive mode is only supported with text output
+func (rb *ResultsBuilder) EndUpdateReview(isAccepted bool) {
+}
+
+// EndAllTests does nothing, as results are only returned
+func (rb *ResultsBuilder) EndAllTests() {
+}
+
+func (rb *ResultsBuilder) IsSuccessful() bool {
+	for _, result := range rb.results {
+		if !result.isSuccessful() {
+			return false
+		}
+	}
+	return true
+}
+
+func (rb *ResultsBuilder) Results() []TestResult {
+	return rb.results
+}
@@ -0,0 +1,67 @@
+package testchart
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// retryBackoff is the delay before first retry, doubled for each subsequent one
+var retryBackoff = time.Second
+
+// transientErrorMessages are fragments of error messages denoting transient network
+// failures, for errors that do not wrap their cause (eg: HTTP errors of helm getters)
+var transientErrorMessages = []string{
+	"connection reset",
+	"connection refused",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"429 Too Many Requests",
+}
+
+// withRetries calls given function, retrying it up to given number of times, with
+// exponential backoff, as long as it fails with a transient error, logging each
+// failed attempt
+func withRetries(description string, retries int, fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > retries || !isTransientError(err) {
+			return err
+		}
+		Logf(LogLevelWarn, "%s failed (attempt %d of %d), retrying in %s: %v", description, attempt, retries+1, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransientError returns whether given error is due to a network failure or
+// timeout that may not happen again, as opposed to an error of chart or tests
+func isTransientError(err error) bool {
+	if errors.Is(err, errTestTimeout) {
+		// Timeout of test itself is enforced, rather than transient
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	message := err.Error()
+	for _, fragment := range transientErrorMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
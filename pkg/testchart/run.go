@@ -0,0 +1,1753 @@
+package testchart
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/postrender"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/strvals"
+
+	"github.com/yannh/kubeconform/pkg/validator"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// Output settings, as set by SetOutputOptions
+var (
+	saveActual        = false
+	keepActual        = false
+	showValues        = false
+	showAllValues     = false
+	debugOutput       = ""
+	redact            = false
+	outputFormat      = "text"
+	quiet             = false
+	noColor           = false
+	ascii             = false
+	githubAnnotations = false
+	summaryTable      = false
+	noDurations       = false
+	logLevel          = LogLevelWarn
+	slowest           = 0
+	diffContext       = DefaultDiffContext
+)
+
+// RunOptions holds the options that apply to a whole test run
+type RunOptions struct {
+	TestPath             string
+	ConfigPath           string
+	Namespace            string
+	Release              string
+	Chart                string
+	ChartVersion         string
+	AppVersion           string
+	IsUpdate             bool
+	UpdateFormattingOnly bool
+	DryRun               bool
+	IgnorePatterns       []string
+	OnlyPatterns         []string
+	SplitExpected        bool
+	JSONKinds            []string
+	IgnoreKinds          []string
+	RequiredLabels       map[string]string
+	ExpandEnv            bool
+	UpdateDependencies   bool
+	Retries              int
+	ShowOnly             []string
+	NoHooks              bool
+	NoTestHooks          bool
+	MaskVersions         bool
+	SortLists            []ListSort
+	Substitutions        []Substitution
+	SortRBACRules        bool
+	StripStatus          bool
+	IgnoreSource         bool
+	Structural           bool
+	DecodeSecrets        bool
+	Interactive          bool
+	PostRun              string
+	FailFast             bool
+	Coverage             bool
+	SchemaPath           string
+	SchemaDef            string
+	KubeVersions         []string
+	SchemaLocations      []string
+	FailOnMissingSchemas bool
+	StrictValidation     bool
+	NoValidate           bool
+	ValidationWarnOnly   bool
+	WarningsAsErrors     bool
+	AllowedExtras        []string
+	SetValues            []string
+	SetStringValues      []string
+	DiffOut              string
+	Timeout              time.Duration
+	Tags                 []string
+	Failed               bool
+
+	// Settings of output that also affect results, which RunTests takes from output
+	// options (see SetOutputOptions), while Run only takes them from here
+	Redact      bool
+	DiffContext int
+	SaveActual  bool
+	KeepActual  bool
+	DebugOutput string
+}
+
+// Names of release and namespace used for rendering chart, unless specified in
+// options or config file
+const (
+	defaultRelease   = "my-release"
+	defaultNamespace = "my-namespace"
+)
+
+// DefaultRunOptions returns the options used for running tests when not overridden
+// (release and namespace are left empty, so that those of config file apply, if any)
+func DefaultRunOptions() RunOptions {
+	return RunOptions{
+		TestPath:         "tests",
+		StrictValidation: true,
+		DiffContext:      DefaultDiffContext,
+	}
+}
+
+// errNoTests is returned when tests directory does not exist or has no tests
+var errNoTests = errors.New("no tests found")
+
+// errNoFailedTests is returned when only last run failures are to be run, but none
+// failed
+var errNoFailedTests = errors.New("no tests failed in last run")
+
+// RunTests runs given tests (or all tests if none given), printing their results,
+// and returns the exit code reflecting their outcome
+func RunTests(args []string, opts RunOptions) (int, error) {
+	opts.Redact = redact
+	opts.DiffContext = diffContext
+	opts.SaveActual = saveActual
+	opts.KeepActual = keepActual
+	opts.DebugOutput = debugOutput
+	results, err := runTests(args, opts, outputFormat)
+	switch {
+	case errors.Is(err, errNoTests):
+		fmt.Println("No tests found")
+		return ExitCodeSuccess, nil
+	case errors.Is(err, errNoFailedTests):
+		fmt.Println("No tests failed in last run")
+		return ExitCodeSuccess, nil
+	case err != nil:
+		return ExitCodeError, err
+	}
+	return exitCodeOf(results), nil
+}
+
+// Run runs given tests (or all tests if none given) without printing their results,
+// and returns them for inspecting them programmatically (eg: from a go test). It
+// only depends on given options, rather than on output options, so that it may be
+// called concurrently, and only prints diagnostics to stderr (see Logf). Running no
+// tests at all is an error, as it most likely denotes a misconfigured tests path,
+// unless only failures of last run were to be run and none failed.
+func Run(opts RunOptions, tests ...string) (Results, error) {
+	results, err := runTests(tests, opts, "none")
+	if errors.Is(err, errNoFailedTests) {
+		return newResults(nil), nil
+	}
+	if err == nil && len(results) == 0 {
+		err = errNoTests
+	}
+	if errors.Is(err, errNoTests) {
+		return Results{}, fmt.Errorf("%w in %s", errNoTests, opts.TestPath)
+	}
+	if err != nil {
+		return Results{}, err
+	}
+	return newResults(results), nil
+}
+
+// runTests runs given tests (or all tests if none given), reporting them with the
+// builder of given output format, and returns their results
+func runTests(args []string, opts RunOptions, format string) ([]TestResult, error) {
+	if _, err := os.Stat(opts.TestPath); os.IsNotExist(err) {
+		return nil, errNoTests
+	}
+
+	config, err := loadConfig(opts)
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	opts = applyConfig(opts, config)
+
+	schema, err := loadCueSchema(cueSchemaOptions(opts, config))
+	if err != nil {
+		return nil, fmt.Errorf("loading cue schema: %w", err)
+	}
+
+	testNames, err := resolveTests(args, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Failed && len(args) == 0 && len(testNames) == 0 {
+		return nil, errNoFailedTests
+	}
+	Logf(LogLevelInfo, "Running %d tests of %s", len(testNames), opts.TestPath)
+
+	if opts.Interactive && format != "text" {
+		return nil, fmt.Errorf("interactive mode is only supported with text output")
+	}
+	if opts.Interactive && summaryTable {
+		return nil, fmt.Errorf("summary table cannot be combined with interactive mode")
+	}
+	if opts.Interactive && opts.DryRun {
+		return nil, fmt.Errorf("dry-run cannot be combined with interactive mode")
+	}
+	builder, err := newBuilder(format, opts.IsUpdate, opts.Interactive, opts.DryRun, recordSettings{redact: opts.Redact, diffContext: opts.DiffContext})
+	if err != nil {
+		return nil, err
+	}
+	builder.StartAllTests(testNames)
+
+	// Create install action
+	settings := cli.New()
+	var postRenderer postrender.PostRenderer
+	if config.PostRenderer != nil {
+		postRenderer, err = postrender.NewExec(config.PostRenderer.Command, config.PostRenderer.Args...)
+		if err != nil {
+			return nil, fmt.Errorf("creating post-renderer: %w", err)
+		}
+	}
+	installAction, err := newInstallAction(settings, opts, postRenderer, &WarningRecorder{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Load chart
+	var chartPath string
+	err = withRetries("Locating chart", opts.Retries, func() (err error) {
+		chartPath, err = locateChart(opts.Chart, settings, installAction)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("locating chart: %w", err)
+	}
+	theChart, err := loadChart(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading chart: %w", err)
+	}
+	Logf(LogLevelInfo, "Testing chart %s %s from %s, with release %s in namespace %s", theChart.Name(), theChart.Metadata.Version, chartPath, opts.Release, opts.Namespace)
+	theChart, err = ensureDependencies(theChart, chartPath, settings, opts.UpdateDependencies, opts.Retries)
+	if err != nil {
+		return nil, fmt.Errorf("resolving chart dependencies: %w", err)
+	}
+
+	// Optionally override chart and app versions
+	if opts.ChartVersion != "" {
+		theChart.Metadata.Version = opts.ChartVersion
+	}
+	if opts.AppVersion != "" {
+		theChart.Metadata.AppVersion = opts.AppVersion
+	}
+
+	// Ensure templates to show exist in chart
+	if err := checkShowOnlyTemplates(theChart, opts.ShowOnly); err != nil {
+		return nil, err
+	}
+
+	for _, testName := range testNames {
+		// Render each test with its own install action and warning recorder, as
+		// those of a timed out rendering remain in use in background
+		warnings := &WarningRecorder{}
+		installAction, err := newInstallAction(settings, opts, postRenderer, warnings)
+		if err != nil {
+			return nil, err
+		}
+		err = runTest(builder, theChart, installAction, warnings, opts, testName, schema)
+		if errors.Is(err, errQuitUpdate) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("running test %s: %w", testName, err)
+		}
+		if results := builder.Results(); opts.FailFast && !results[len(results)-1].isSuccessful() {
+			break
+		}
+	}
+
+	builder.EndAllTests()
+
+	// Only remember failures of interactive runs, as diff output and library runs
+	// must not touch disk
+	if !opts.IsUpdate && (format == "text" || format == "markdown") {
+		if err := saveRunCache(opts.TestPath, builder.Results()); err != nil {
+			return nil, fmt.Errorf("saving results of run: %w", err)
+		}
+	}
+	if opts.Coverage && format != "none" {
+		printCoverage(theChart, builder.Results())
+	}
+	if opts.DiffOut != "" {
+		if err := writeDiffs(opts.DiffOut, builder.Results()); err != nil {
+			return nil, err
+		}
+	}
+	if githubAnnotations && format == "text" {
+		printGitHubAnnotations(opts.TestPath, builder.Results())
+	}
+	if opts.PostRun != "" {
+		runPostRunCommand(opts.PostRun, builder.Results())
+	}
+	return builder.Results(), nil
+}
+
+// newInstallAction returns an install action rendering chart without cluster access,
+// with its own action config, so that install actions share no state
+func newInstallAction(settings *cli.EnvSettings, opts RunOptions, postRenderer postrender.PostRenderer, warnings *WarningRecorder) (*action.Install, error) {
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), opts.Namespace, "memory", warnings.Log); err != nil {
+		return nil, fmt.Errorf("initializing helm action: %w", err)
+	}
+	installAction := action.NewInstall(actionConfig)
+	installAction.Namespace = opts.Namespace
+	installAction.ReleaseName = opts.Release
+	installAction.DryRun = true
+	installAction.IncludeCRDs = true
+	installAction.ClientOnly = true
+	installAction.Replace = true
+	installAction.DisableHooks = opts.NoHooks
+	installAction.PostRenderer = postRenderer
+	return installAction, nil
+}
+
+// discoverTests returns the names of all tests found recursively in given tests
+// directory, where a test is any directory containing a values file (along with an
+// expected file, expected error file or assertions file, unless it is a new test),
+// named after its path relative to tests directory (eg: "ingress/tls")
+func discoverTests(testPath string) ([]string, error) {
+	var testNames []string
+	err := filepath.WalkDir(testPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != testPath && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !hasValuesFile(path) {
+			return nil
+		}
+		name, err := filepath.Rel(testPath, path)
+		if err != nil {
+			return err
+		}
+		if name != "." {
+			testNames = append(testNames, filepath.ToSlash(name))
+		}
+		return nil
+	})
+	return testNames, err
+}
+
+// resolveTests returns the names of tests to run, as selected by given patterns (or
+// all tests if none given), tags and, unless patterns are given, last run failures
+func resolveTests(args []string, opts RunOptions) ([]string, error) {
+	testNames, err := selectTests(opts.TestPath, args)
+	if err != nil {
+		return nil, err
+	}
+	testNames, err = filterTestsByTags(opts.TestPath, testNames, opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Failed && len(args) == 0 {
+		return filterFailedTests(opts.TestPath, testNames)
+	}
+	return testNames, nil
+}
+
+// selectTests returns the names of discovered tests matching given glob patterns (eg:
+// "ingress-*"), or all discovered tests if no patterns given. Patterns without glob
+// metacharacters also select tests not discovered yet (eg: lacking an expected file).
+func selectTests(testPath string, patterns []string) ([]string, error) {
+	allNames, err := discoverTests(testPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return allNames, nil
+	}
+
+	var testNames []string
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid test pattern %q: %w", pattern, err)
+		}
+		matched := false
+		for _, name := range allNames {
+			if isMatch, _ := path.Match(pattern, name); isMatch {
+				matched = true
+				if !contains(testNames, name) {
+					testNames = append(testNames, name)
+				}
+			}
+		}
+		if !matched && !strings.ContainsAny(pattern, "*?[") && fileExists(filepath.Join(testPath, pattern)) {
+			matched = true
+			if !contains(testNames, pattern) {
+				testNames = append(testNames, pattern)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no tests matched %q", pattern)
+		}
+	}
+	return testNames, nil
+}
+
+// matchesTestPatterns returns whether given test name matches any of given glob patterns
+func matchesTestPatterns(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if isMatch, _ := path.Match(pattern, name); isMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// applyConfig returns given options merged with those of config file, where options
+// set on command line take precedence
+func applyConfig(opts RunOptions, config Config) RunOptions {
+	if config.SkipHooks {
+		opts.NoHooks = true
+	}
+	if config.SkipTestHooks {
+		opts.NoTestHooks = true
+	}
+	// Config file lists are appended to those of caller, rather than replacing them
+	opts.SortLists = append(append([]ListSort{}, opts.SortLists...), config.SortLists...)
+	if config.SplitExpected {
+		opts.SplitExpected = true
+	}
+	opts.JSONKinds = append(append([]string{}, opts.JSONKinds...), config.JSONKinds...)
+	opts.IgnoreKinds = append(append([]string{}, opts.IgnoreKinds...), config.IgnoreKinds...)
+	if len(config.RequiredLabels) > 0 {
+		// Labels required by caller take precedence over those of config file
+		requiredLabels := make(map[string]string, len(config.RequiredLabels)+len(opts.RequiredLabels))
+		for name, value := range config.RequiredLabels {
+			requiredLabels[name] = value
+		}
+		for name, value := range opts.RequiredLabels {
+			requiredLabels[name] = value
+		}
+		opts.RequiredLabels = requiredLabels
+	}
+	if config.ExpandEnv {
+		opts.ExpandEnv = true
+	}
+	// Command line takes precedence over config file, then over built-in defaults
+	opts.Release = firstNonEmpty(opts.Release, config.Release, defaultRelease)
+	opts.Namespace = firstNonEmpty(opts.Namespace, config.Namespace, defaultNamespace)
+	if len(opts.IgnorePatterns) == 0 {
+		opts.IgnorePatterns = config.IgnoreLines
+	}
+	if len(opts.OnlyPatterns) == 0 {
+		opts.OnlyPatterns = config.OnlyLines
+	}
+	opts.Substitutions = append(append([]Substitution{}, opts.Substitutions...), config.Substitutions...)
+	if config.SortRBACRules {
+		opts.SortRBACRules = true
+	}
+	if config.MaskVersions {
+		opts.MaskVersions = true
+	}
+	if config.StripStatus {
+		opts.StripStatus = true
+	}
+	if config.IgnoreSource {
+		opts.IgnoreSource = true
+	}
+	if config.Structural {
+		opts.Structural = true
+	}
+	if len(opts.SchemaLocations) == 0 {
+		opts.SchemaLocations = config.SchemaLocations
+	}
+	if config.FailOnMissingSchemas {
+		opts.FailOnMissingSchemas = true
+	}
+	if config.StrictValidation != nil && !*config.StrictValidation {
+		opts.StrictValidation = false
+	}
+	if config.SkipValidation {
+		opts.NoValidate = true
+	}
+	if config.ValidationWarnOnly {
+		opts.ValidationWarnOnly = true
+	}
+	if config.WarningsAsErrors {
+		opts.WarningsAsErrors = true
+	}
+	return opts
+}
+
+// firstNonEmpty returns the first of given values that is not empty, if any
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// newBuilder returns the builder for given output format, recording items of tests
+// with given settings
+func newBuilder(format string, isUpdate, isInteractive, isDryRun bool, settings recordSettings) (Builder, error) {
+	switch format {
+	case "text":
+		if summaryTable {
+			builder := NewTableBuilder(isUpdate, isDryRun)
+			builder.recordSettings = settings
+			return builder, nil
+		}
+		builder := NewPrintBuilder(isUpdate, isInteractive, isDryRun)
+		builder.recordSettings = settings
+		return builder, nil
+	case "markdown":
+		builder := NewMarkdownBuilder(isUpdate, isDryRun)
+		builder.recordSettings = settings
+		return builder, nil
+	case "diff":
+		builder := NewDiffBuilder()
+		builder.recordSettings = settings
+		return builder, nil
+	case "none":
+		builder := NewResultsBuilder()
+		builder.recordSettings = settings
+		return builder, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+func runTest(builder Builder, theChart *chart.Chart, installAction *action.Install, warnings *WarningRecorder, opts RunOptions, testName string, schema *cue.Value) error {
+	builder.StartTest(testName)
+	startTime := time.Now()
+	updates, err := evaluateTest(builder, theChart, installAction, warnings, opts, testName, schema)
+	builder.SetDuration(time.Since(startTime))
+	if err != nil {
+		// Report error as a failed test, without aborting other tests
+		builder.SetTestError(err)
+		updates = nil
+	}
+	if err := endTest(builder, opts, testName, updates); err != nil {
+		return err
+	}
+	if opts.KeepActual && !opts.SaveActual {
+		return removePassedActual(builder, opts, testName)
+	}
+	return nil
+}
+
+// removePassedActual removes the actual.yaml file of given test if it passed, so
+// that only failed or invalid tests keep theirs
+func removePassedActual(builder Builder, opts RunOptions, testName string) error {
+	results := builder.Results()
+	if len(results) == 0 {
+		return nil
+	}
+	if result := results[len(results)-1]; result.name != testName || !result.isSuccessful() {
+		return nil
+	}
+	err := os.Remove(filepath.Join(opts.TestPath, testName, actualFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing %s file of passed test: %w", actualFileName, err)
+	}
+	return nil
+}
+
+// evaluateTest renders and compares given test, reporting results to builder, and
+// returns the expected files to be updated, if any
+func evaluateTest(builder Builder, theChart *chart.Chart, installAction *action.Install, warnings *WarningRecorder, opts RunOptions, testName string, schema *cue.Value) ([]fileUpdate, error) {
+	// Render a copy of chart, as helm alters subcharts according to values
+	theChart = cloneChart(theChart)
+
+	// Apply test-specific overrides of namespace, release and api versions
+	testConfig, err := loadTestConfig(filepath.Join(opts.TestPath, testName))
+	if err != nil {
+		return nil, fmt.Errorf("loading test config: %w", err)
+	}
+	installAction.Namespace = opts.Namespace
+	if testConfig.Namespace != nil {
+		installAction.Namespace = *testConfig.Namespace
+	}
+	installAction.ReleaseName = opts.Release
+	if testConfig.Release != nil {
+		installAction.ReleaseName = *testConfig.Release
+	}
+	installAction.APIVersions = testConfig.APIVersions
+
+	// Load test values file
+	testValuesPath := valuesFilePath(filepath.Join(opts.TestPath, testName))
+	testValues, err := loadValuesFile(testValuesPath, opts.ExpandEnv)
+	if err != nil {
+		return nil, fmt.Errorf("parsing test values file %q: %w", testValuesPath, err)
+	}
+	Logf(LogLevelDebug, "Rendering test %s with values of %s", testName, testValuesPath)
+
+	testValues = standardizeTree(testValues)
+
+	// Override test values with those set on command line
+	if testValues == nil {
+		testValues = map[string]interface{}{}
+	}
+	for _, value := range opts.SetValues {
+		if err := strvals.ParseInto(value, testValues); err != nil {
+			return nil, fmt.Errorf("parsing --set value %q: %w", value, err)
+		}
+	}
+	for _, value := range opts.SetStringValues {
+		if err := strvals.ParseIntoString(value, testValues); err != nil {
+			return nil, fmt.Errorf("parsing --set-string value %q: %w", value, err)
+		}
+	}
+
+	// Validate values with cue schema, if any, and JSON schema of chart (discarding
+	// warnings of coalescing), reporting violations like rendering errors, so that
+	// negative tests may expect them
+	var valuesErr error
+	if schema != nil {
+		testValues, valuesErr = applySchema(schema, testValues, testValuesPath, opts.ExpandEnv)
+	}
+	if valuesErr == nil {
+		warnings.Start()
+		valuesErr = validateJSONSchema(theChart, testValues)
+		warnings.Stop()
+	}
+
+	// Render chart templates, capturing warnings logged by helm
+	var release *release.Release
+	var actualWarnings []string
+	err = valuesErr
+	if valuesErr == nil {
+		// Show coalesced values
+		builder.ShowValues(func() (string, error) {
+			values, err := coalesceValues(theChart, installAction, testValues)
+			if err != nil {
+				return "", err
+			}
+			return marshalValues(values)
+		})
+
+		err = withRetries("Rendering test "+testName, opts.Retries, func() (err error) {
+			warnings.Start()
+			release, err = renderChart(installAction, theChart, testValues, opts.Timeout)
+			actualWarnings = warnings.Stop()
+			return err
+		})
+		if errors.Is(err, errTestTimeout) {
+			return nil, err
+		}
+		if opts.DebugOutput != "" {
+			file, err := func() (io.WriteCloser, error) {
+				if opts.DebugOutput == "-" {
+					return NopWriterCloser{os.Stderr}, nil
+				}
+				return os.Create(opts.DebugOutput)
+			}()
+			if err == nil {
+				if release != nil {
+					_, _ = file.Write([]byte(release.Manifest))
+				}
+				_ = file.Close()
+			}
+		}
+	}
+
+	// Negative test expecting rendering to fail?
+	expectedErrorPath := filepath.Join(opts.TestPath, testName, expectedErrorFileName)
+	expectedErrorBytes, readErr := os.ReadFile(expectedErrorPath)
+	if readErr == nil {
+		// Unless updating, which records actual error in it
+		if strings.TrimSpace(string(expectedErrorBytes)) == "" && !opts.IsUpdate {
+			return nil, fmt.Errorf("%s file is empty, expecting a fragment or regular expression of expected error (run update to record actual error)", expectedErrorFileName)
+		}
+		isExpectedError := checkExpectedError(builder, string(expectedErrorBytes), err)
+		builder.SetTestComparisonResult(isExpectedError)
+		var updates []fileUpdate
+		if opts.IsUpdate && !isExpectedError && err != nil {
+			updates = append(updates, fileUpdate{path: expectedErrorPath, content: []byte(strings.TrimSpace(err.Error()) + "\n")})
+		}
+		if !opts.Interactive && !opts.DryRun {
+			if err := writeUpdates(updates); err != nil {
+				return nil, err
+			}
+		}
+		return updates, nil
+	} else if !errors.Is(readErr, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s file: %w", expectedErrorFileName, readErr)
+	}
+	if valuesErr != nil {
+		return nil, valuesErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rendering chart: %w", err)
+	}
+
+	// Combine regular manifests and hook manifests, with test hooks in their own
+	// section
+	var hooks, testHooks bytes.Buffer
+	if !opts.NoHooks {
+		for _, m := range sortedHooks(release.Hooks) {
+			if !isTestHook(m) {
+				_, _ = fmt.Fprintf(&hooks, "---\n# Source: %s\n%s\n", m.Path, m.Manifest)
+			} else if !opts.NoTestHooks {
+				_, _ = fmt.Fprintf(&testHooks, "---\n# Source: %s\n%s\n", m.Path, m.Manifest)
+			}
+		}
+	}
+	actualManifest := joinSections(release.Manifest, hooks.String(), testHooks.String())
+	builder.SetRenderedSources(renderedSources(actualManifest))
+	checkDuplicateResources(builder, actualManifest, installAction.Namespace, opts)
+	checkRequiredLabels(builder, actualManifest, opts)
+
+	// Only keep templates to show
+	if len(opts.ShowOnly) > 0 {
+		actualManifest = filterManifest(actualManifest, opts.ShowOnly, true)
+	}
+	builder.SetEmptyRender(len(splitManifestSections(actualManifest, false)) == 0)
+
+	// Check assertions on rendered resources
+	testDir := filepath.Join(opts.TestPath, testName)
+	assertions, err := loadAssertions(testDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", assertionsFileName, err)
+	}
+	checkAssertions(builder, assertions, actualManifest)
+
+	// Save actual.yaml for troubleshooting purposes
+	if opts.SaveActual || opts.KeepActual {
+		actualPath := filepath.Join(opts.TestPath, testName, actualFileName)
+		err := os.WriteFile(actualPath, []byte(actualManifest), 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("writing %s file for debug purposes: %w", actualFileName, err)
+		}
+	}
+
+	// Read expected manifest, unless test only has assertions. A test having neither
+	// is new, and gets compared against an empty manifest, until its expected file is
+	// created on update.
+	hasExpectedManifest := hasExpected(testDir)
+	isNewTest := !hasExpectedManifest && !fileExists(filepath.Join(testDir, assertionsFileName))
+	originalExpectedManifest := ""
+	if hasExpectedManifest {
+		originalExpectedManifest, err = readExpectedManifest(testDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	expectedManifest, actualManifest, err := prepareManifests(testDir, originalExpectedManifest, actualManifest, testConfig, theChart.Metadata, opts)
+	if err != nil {
+		return nil, err
+	}
+	jsonKinds := append(append([]string{}, opts.JSONKinds...), testConfig.JSONKinds...)
+
+	// Compare, tolerating extra resources allowed by caller or by this test
+	isEqual := !isNewTest
+	if hasExpectedManifest || isNewTest {
+		compareOpts := opts
+		compareOpts.AllowedExtras = append(append([]string{}, opts.AllowedExtras...), testConfig.AllowedExtras...)
+		isEqual = compareManifests(builder, expectedManifest, actualManifest, compareOpts) && isEqual
+	}
+
+	// Compare warnings, only if expected for this test (or to create them on update)
+	expectedWarningsPath := filepath.Join(opts.TestPath, testName, expectedWarningsFileName)
+	actualWarningsText := ""
+	if len(actualWarnings) > 0 {
+		actualWarningsText = strings.Join(actualWarnings, "\n") + "\n"
+	}
+	areWarningsEqual := true
+	expectedWarningsBytes, err := os.ReadFile(expectedWarningsPath)
+	if err == nil {
+		expectedWarnings := strings.TrimSpace(normalizeEncoding(string(expectedWarningsBytes)))
+		if expectedWarnings != strings.TrimSpace(actualWarningsText) {
+			builder.AddDifferentItem(expectedWarningsFileName, expectedWarnings, strings.TrimSpace(actualWarningsText))
+			areWarningsEqual = false
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s file: %w", expectedWarningsFileName, err)
+	} else if opts.IsUpdate && len(actualWarnings) > 0 {
+		// Report warnings file to be created like any other item
+		builder.AddExtraItem(expectedWarningsFileName, strings.TrimSpace(actualWarningsText))
+		areWarningsEqual = false
+	} else {
+		reportRenderWarnings(builder, actualWarnings, opts)
+	}
+
+	// Compare rendered notes, only if expected for this test (or to create them on update)
+	areNotesEqual, actualNotesText, err := compareNotes(builder, testDir, release.Info.Notes, opts.IsUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare coalesced values, only if expected for this test
+	expectedValuesPath := filepath.Join(opts.TestPath, testName, expectedValuesFileName)
+	areValuesEqual := true
+	actualValuesYaml := ""
+	expectedValuesBytes, err := os.ReadFile(expectedValuesPath)
+	if err == nil {
+		expectedValues, err := unmarshalMapSlice(expectedValuesBytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s file: %w", expectedValuesFileName, err)
+		}
+		expectedValuesYaml, err := marshalValues(expectedValues)
+		if err != nil {
+			return nil, err
+		}
+
+		// Discard warnings already captured during rendering
+		warnings.Start()
+		actualValues, err := coalesceValues(theChart, installAction, testValues)
+		warnings.Stop()
+		if err != nil {
+			return nil, err
+		}
+		actualValuesYaml, err = marshalValues(projectValues(expectedValues, actualValues))
+		if err != nil {
+			return nil, err
+		}
+
+		if expectedValuesYaml != actualValuesYaml {
+			builder.AddDifferentItem(expectedValuesFileName, expectedValuesYaml, actualValuesYaml)
+			areValuesEqual = false
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s file: %w", expectedValuesFileName, err)
+	}
+
+	builder.SetTestComparisonResult(isEqual && areWarningsEqual && areNotesEqual && areValuesEqual)
+
+	// Update expected? Unless only formatting changes are to be accepted, in which
+	// case tests with semantic changes are left failing, to be updated explicitly
+	var updates []fileUpdate
+	hasSemanticChanges := isNewTest || !isEqual || !areWarningsEqual || !areNotesEqual || !areValuesEqual
+	if opts.IsUpdate || (opts.UpdateFormattingOnly && !hasSemanticChanges) {
+		if !areValuesEqual {
+			updates = append(updates, fileUpdate{path: expectedValuesPath, content: []byte(actualValuesYaml + "\n")})
+		}
+		if !areWarningsEqual {
+			updates = append(updates, fileUpdate{path: expectedWarningsPath, content: []byte(actualWarningsText)})
+		}
+		if !areNotesEqual {
+			updates = append(updates, fileUpdate{path: filepath.Join(testDir, expectedNotesFileName), content: []byte(actualNotesText)})
+		}
+		isSplit := opts.SplitExpected || isSplitExpected(testDir)
+		isFormatChanged := isSplit != isSplitExpected(testDir) || hasNonCanonicalJSONKinds(originalExpectedManifest, jsonKinds)
+		if hasExpectedManifest && !isFormatChanged {
+			if isFormatChanged, err = hasNonCanonicalExpectedFiles(testDir); err != nil {
+				return nil, err
+			}
+		}
+		if isNewTest || (hasExpectedManifest && (!isEqual || isFormatChanged)) {
+			updatedManifest := restorePlaceholders(originalExpectedManifest, actualManifest)
+			if len(opts.ShowOnly) > 0 {
+				// Leave entries for templates not shown untouched, in their original order
+				shownExpected := filterManifest(originalExpectedManifest, opts.ShowOnly, true)
+				updatedManifest = mergeShownManifest(originalExpectedManifest, restorePlaceholders(shownExpected, actualManifest), opts.ShowOnly)
+			}
+			manifestUpdates, err := expectedUpdates(testDir, updatedManifest, isSplit)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, manifestUpdates...)
+		}
+	}
+	if !opts.Interactive && !opts.DryRun {
+		if err := writeUpdates(updates); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate
+	if !opts.NoValidate {
+		validatedManifest := release.Manifest
+		if len(opts.ShowOnly) > 0 {
+			validatedManifest = filterManifest(validatedManifest, opts.ShowOnly, true)
+		}
+		err = validateManifest(builder, validatedManifest, opts)
+		if err != nil {
+			return nil, fmt.Errorf("validating manifest: %w", err)
+		}
+	}
+
+	if isNewTest && !opts.IsUpdate {
+		return nil, fmt.Errorf("missing %s file, run `testchart update %s` to create it from rendered manifests", expectedFileName, testName)
+	}
+	return updates, nil
+}
+
+// prepareManifests filters, masks and converts given expected and actual manifests
+// of given test, according to options and test config, so that they can be compared
+func prepareManifests(testDir, originalExpectedManifest, actualManifest string, testConfig TestConfig, metadata *chart.Metadata, opts RunOptions) (string, string, error) {
+	expectedManifest := trimHookSections(originalExpectedManifest, opts)
+	if len(opts.ShowOnly) > 0 {
+		expectedManifest = filterManifest(expectedManifest, opts.ShowOnly, true)
+	}
+
+	// Filter manifests for global and test-specific ignored patterns
+	testIgnorePatterns, err := loadTestIgnorePatterns(testDir)
+	if err != nil {
+		return "", "", fmt.Errorf("loading %s: %w", testIgnoreFileName, err)
+	}
+	ignorePatterns := append(append([]string{}, opts.IgnorePatterns...), testIgnorePatterns...)
+	ignoreExpressions, err := compileIgnorePatterns(ignorePatterns)
+	if err != nil {
+		return "", "", fmt.Errorf("compiling ignore patterns: %w", err)
+	}
+	if len(opts.OnlyPatterns) > 0 {
+		if len(ignorePatterns) > 0 {
+			return "", "", fmt.Errorf("only-match patterns cannot be combined with ignore patterns")
+		}
+		onlyExpressions, err := compileIgnorePatterns(opts.OnlyPatterns)
+		if err != nil {
+			return "", "", fmt.Errorf("compiling only-match patterns: %w", err)
+		}
+		actualManifest = keepLinesMatchingPatterns(actualManifest, onlyExpressions)
+		expectedManifest = keepLinesMatchingPatterns(expectedManifest, onlyExpressions)
+	}
+	actualManifest = removeLinesMatchingPatterns(actualManifest, ignoreExpressions)
+	expectedManifest = removeLinesMatchingPatterns(expectedManifest, ignoreExpressions)
+
+	// Mask volatile substrings
+	substitutions, err := compileSubstitutions(opts.Substitutions)
+	if err != nil {
+		return "", "", fmt.Errorf("compiling substitutions: %w", err)
+	}
+	if opts.MaskVersions {
+		substitutions = append(substitutions, versionLabelSubstitutions(metadata)...)
+	}
+	actualManifest = applySubstitutions(actualManifest, substitutions)
+	expectedManifest = applySubstitutions(expectedManifest, substitutions)
+
+	// Convert configured kinds to canonical JSON, globally or for this test only
+	jsonKinds := append(append([]string{}, opts.JSONKinds...), testConfig.JSONKinds...)
+	actualManifest = convertKindsToJSON(actualManifest, jsonKinds)
+	expectedManifest = convertKindsToJSON(expectedManifest, jsonKinds)
+
+	// Accept volatile values matching placeholders of expected manifest
+	expectedManifest = resolvePlaceholders(expectedManifest, actualManifest)
+	return expectedManifest, actualManifest, nil
+}
+
+// endTest ends current test and, in interactive mode, lets user review given
+// pending updates before writing them
+func endTest(builder Builder, opts RunOptions, testName string, updates []fileUpdate) error {
+	if err := builder.EndTest(); err != nil {
+		return err
+	}
+
+	// Let user review changes before updating expected files
+	if opts.Interactive && len(updates) > 0 {
+		decision, err := promptUpdateDecision(testName)
+		if err != nil {
+			return err
+		}
+		if decision == acceptUpdate {
+			if err := writeUpdates(updates); err != nil {
+				return err
+			}
+		}
+		builder.EndUpdateReview(decision == acceptUpdate)
+		if decision == quitUpdate {
+			return errQuitUpdate
+		}
+	}
+	return nil
+}
+
+// fileUpdate is an expected file to be written with actual content, or removed
+type fileUpdate struct {
+	path      string
+	content   []byte
+	isRemoved bool
+}
+
+func writeUpdates(updates []fileUpdate) error {
+	for _, update := range updates {
+		if update.isRemoved {
+			if err := os.Remove(update.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("removing stale %s file: %w", filepath.Base(update.path), err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(update.path), 0o755); err != nil {
+			return fmt.Errorf("creating directory of %s file: %w", filepath.Base(update.path), err)
+		}
+		if err := os.WriteFile(update.path, update.content, 0o644); err != nil {
+			return fmt.Errorf("writing updated %s file: %w", filepath.Base(update.path), err)
+		}
+		Logf(LogLevelDebug, "Wrote %s", update.path)
+	}
+	return nil
+}
+
+// standardizeTree converts the maps having non-string keys (eg: `80:` or `true:`),
+// which yaml.v3 decodes as map[interface{}]interface{}, to map[string]interface{}
+func standardizeTree(node map[string]interface{}) map[string]interface{} {
+	return standardizeNode(node).(map[string]interface{})
+}
+
+func standardizeNode(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[interface{}]interface{}:
+		newNode := map[string]interface{}{}
+		for key, value := range v {
+			// Non-string keys are stringified, as helm does
+			newNode[fmt.Sprint(key)] = standardizeNode(value)
+		}
+		return newNode
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = standardizeNode(value)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = standardizeNode(elem)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func loadValuesFile(filePath string, isEnvExpanded bool) (map[string]interface{}, error) {
+	yamlFile, err := readValuesFile(filePath, isEnvExpanded)
+	if err != nil {
+		return nil, err
+	}
+
+	if filepath.Ext(filePath) == ".json" {
+		return unmarshalJSONValues(yamlFile)
+	}
+
+	var data map[string]interface{}
+	err = yaml.Unmarshal(yamlFile, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// validateManifest validates given manifest against the schemas of configured kubernetes
+// versions (or of latest version if none configured), reporting invalid resources to
+// builder. Resources invalid only for some versions are tagged with those versions.
+func validateManifest(builder Builder, manifest string, opts RunOptions) error {
+	kubeVersions := opts.KubeVersions
+	if len(kubeVersions) == 0 {
+		kubeVersions = []string{""}
+	}
+
+	type invalidResource struct {
+		signature string
+		errs      []string
+		versions  []string
+	}
+	var invalidResources []*invalidResource
+	for _, kubeVersion := range kubeVersions {
+		v, err := validator.New(opts.SchemaLocations, validator.Opts{
+			Strict:               opts.StrictValidation,
+			IgnoreMissingSchemas: !opts.FailOnMissingSchemas,
+			KubernetesVersion:    normalizeKubeVersion(kubeVersion),
+		})
+		if err != nil {
+			return fmt.Errorf("initializing validator: %w", err)
+		}
+
+		readCloser := io.NopCloser(strings.NewReader(manifest))
+		filePath := "rendered.yaml"
+		for i, res := range v.Validate(filePath, readCloser) { // A file might contain multiple resources
+			// File starts with ---, the parser assumes a first empty resource
+			if res.Status == validator.Invalid || res.Status == validator.Error {
+				sig, err := res.Resource.Signature()
+				if err != nil {
+					return fmt.Errorf("creating signature for invalid resource #%d: %w", i, err)
+				}
+				var resource *invalidResource
+				for _, r := range invalidResources {
+					if r.signature == sig.QualifiedName() {
+						resource = r
+					}
+				}
+				if resource == nil {
+					resource = &invalidResource{signature: sig.QualifiedName()}
+					invalidResources = append(invalidResources, resource)
+				}
+				resource.errs = append(resource.errs, res.Err.Error())
+				resource.versions = append(resource.versions, kubeVersion)
+			}
+		}
+	}
+
+	addValidationError := builder.AddValidationError
+	if opts.ValidationWarnOnly {
+		addValidationError = builder.AddValidationWarning
+	}
+	for _, resource := range invalidResources {
+		if len(resource.versions) == len(kubeVersions) {
+			// Invalid for all versions, only report first error
+			signature := resource.signature
+			if len(kubeVersions) > 1 {
+				signature += " (all kubernetes versions)"
+			}
+			addValidationError(signature, resource.errs[0])
+			continue
+		}
+		for i, version := range resource.versions {
+			addValidationError(fmt.Sprintf("%s (kubernetes %s)", resource.signature, version), resource.errs[i])
+		}
+	}
+	return nil
+}
+
+// normalizeKubeVersion returns given kubernetes version in the major.minor.patch
+// format expected by kubeconform (eg: "1.29" becomes "1.29.0")
+func normalizeKubeVersion(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if strings.Count(version, ".") == 1 {
+		version += ".0"
+	}
+	return version
+}
+
+func removeLinesMatchingPatterns(input string, ignorePatterns []*regexp.Regexp) string {
+	lines := strings.Split(input, "\n")
+	var filteredLines []string
+	for _, line := range lines {
+		match := false
+		for _, pattern := range ignorePatterns {
+			if pattern.MatchString(line) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			filteredLines = append(filteredLines, line)
+		}
+	}
+	return strings.Join(filteredLines, "\n")
+}
+
+// keepLinesMatchingPatterns removes lines of input not matching any of given
+// patterns, always keeping the document delimiters, source comments and hooks
+// markers needed to split manifest into items
+func keepLinesMatchingPatterns(input string, patterns []*regexp.Regexp) string {
+	lines := strings.Split(input, "\n")
+	var filteredLines []string
+	for _, line := range lines {
+		match := line == "---" || strings.HasPrefix(line, "# Source: ") || line == hooksMarker || line == testHooksMarker
+		for _, pattern := range patterns {
+			if match {
+				break
+			}
+			match = pattern.MatchString(line)
+		}
+		if match {
+			filteredLines = append(filteredLines, line)
+		}
+	}
+	return strings.Join(filteredLines, "\n")
+}
+
+func compileIgnorePatterns(ignoreExpressions []string) ([]*regexp.Regexp, error) {
+	var ignorePatterns []*regexp.Regexp
+	for _, expr := range ignoreExpressions {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile ignore pattern %q: %v", expr, err)
+		}
+		ignorePatterns = append(ignorePatterns, pattern)
+	}
+	return ignorePatterns, nil
+}
+
+func compareManifests(builder Builder, expectedManifest, actualManifest string, opts RunOptions) bool {
+	expected := splitManifestSections(normalizeSourceHeaders(normalizeEncoding(expectedManifest)), opts.IgnoreSource)
+	actual := splitManifestSections(normalizeSourceHeaders(normalizeEncoding(actualManifest)), opts.IgnoreSource)
+	normalizeItems(builder, expected, opts, false)
+	normalizeItems(builder, actual, opts, true)
+	// Resolve placeholders left unmatched by resources rendered in another order
+	for _, source := range sortedKeys(expected) {
+		if actualContent, ok := actual[source]; ok {
+			expected[source] = resolvePlaceholders(expected[source], actualContent)
+		}
+	}
+	areEqual := true
+
+	// Ignore items annotated to be skipped on either side
+	for _, items := range []map[string]string{expected, actual} {
+		for _, source := range sortedKeys(items) {
+			if content, ok := items[source]; ok && isSkippedFromComparison(content) {
+				delete(expected, source)
+				delete(actual, source)
+			}
+		}
+	}
+
+	// Ignore items of configured kinds on either side, counting each resource once
+	if len(opts.IgnoreKinds) > 0 {
+		ignoredCount := 0
+		for _, items := range []map[string]string{expected, actual} {
+			for _, source := range sortedKeys(items) {
+				if content, ok := items[source]; ok && contains(opts.IgnoreKinds, resourceKind(content)) {
+					delete(expected, source)
+					delete(actual, source)
+					ignoredCount++
+				}
+			}
+		}
+		builder.SetIgnoredCount(ignoredCount)
+	}
+
+	// Find missing items, in order of sources so that output is stable across runs
+	for _, source := range sortedKeys(expected) {
+		if _, ok := actual[source]; !ok {
+			builder.AddMissingItem(source, expected[source])
+			delete(expected, source)
+			areEqual = false
+		}
+	}
+
+	// Find extra items
+	for _, source := range sortedKeys(actual) {
+		if _, ok := expected[source]; !ok {
+			if isAllowedExtra(actual[source], opts.AllowedExtras) {
+				builder.AddAllowedExtraItem(source)
+				delete(actual, source)
+				continue
+			}
+			builder.AddExtraItem(source, actual[source])
+			delete(actual, source)
+			areEqual = false
+		}
+	}
+
+	// Find different items
+	for _, source := range sortedKeys(expected) {
+		expectedContent := expected[source]
+		if actualContent, ok := actual[source]; ok {
+			if expectedContent != actualContent {
+				path := ""
+				if opts.Structural {
+					var isDifferent bool
+					if path, isDifferent = structuralDifference(expectedContent, actualContent); !isDifferent {
+						delete(actual, source)
+						continue
+					}
+				}
+				if opts.DecodeSecrets {
+					// Only decode for display, comparison is based on actual bytes
+					expectedContent = decodeSecretData(expectedContent)
+					actualContent = decodeSecretData(actualContent)
+				}
+				builder.AddDifferentItemAt(source, path, expectedContent, actualContent)
+				areEqual = false
+			}
+			delete(actual, source)
+		}
+	}
+
+	return areEqual
+}
+
+// splitManifest splits given manifest into items keyed by source and resource identity,
+// or only by resource identity if isSourceIgnored is true
+func splitManifest(buffer string, isSourceIgnored bool) map[string]string {
+	items := make(map[string]string)
+	delimiter := "---\n# Source: "
+
+	// Split the buffer into chunks using the delimiter
+	chunks := strings.Split(buffer, delimiter)
+
+	// Process each chunk
+	for _, chunk := range chunks {
+		// Remove leading and trailing whitespaces
+		chunk = strings.TrimSpace(chunk)
+
+		// Skip empty chunks
+		if chunk == "" {
+			continue
+		}
+
+		// Find the source path and content within the chunk
+		parts := strings.SplitN(chunk, "\n", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		// Extract the source path and content, which may hold several documents
+		// when hand-written under a single source comment
+		sourcePath := strings.TrimSpace(parts[0])
+		for _, content := range splitYAMLDocuments(parts[1]) {
+			// Key by source and resource identity, so that multiple resources
+			// rendered from the same template are compared individually,
+			// regardless of their order
+			key := sourcePath
+			if isSourceIgnored {
+				if resourceKey := resourceKey(content); resourceKey != "" {
+					key = resourceKey
+				}
+			} else if identity := resourceIdentity(content); identity != "" {
+				key = fmt.Sprintf("%s (%s)", sourcePath, identity)
+			}
+
+			current, ok := items[key]
+			if ok {
+				content = current + "\n---\n" + content
+			}
+			// Store the content in the map
+			items[key] = content
+		}
+	}
+
+	return items
+}
+
+// isAllowedExtra returns whether given resource content matches any of given kinds or
+// "kind/name" identities
+func isAllowedExtra(content string, allowedExtras []string) bool {
+	if len(allowedExtras) == 0 {
+		return false
+	}
+	identity := resourceIdentity(content)
+	kind, _, _ := strings.Cut(identity, "/")
+	return identity != "" && (contains(allowedExtras, kind) || contains(allowedExtras, identity))
+}
+
+// sortedKeys returns the keys of given items in lexical order, for iterating over
+// them deterministically
+func sortedKeys(items map[string]string) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitYAMLDocuments splits given content on document delimiter lines, returning its
+// non-empty documents, trimmed
+func splitYAMLDocuments(content string) []string {
+	var documents []string
+	for _, document := range strings.Split("\n"+content+"\n", "\n---\n") {
+		if document = strings.TrimSpace(document); document != "" {
+			documents = append(documents, document)
+		}
+	}
+	return documents
+}
+
+// locateChart returns the local path of given chart, pulling it first from
+// registry if it is an OCI reference
+func locateChart(name string, settings *cli.EnvSettings, installAction *action.Install) (string, error) {
+	if name == "" {
+		name = "."
+	}
+	if !registry.IsOCI(name) {
+		return filepath.Abs(name)
+	}
+
+	registryClient, err := registry.NewClient(
+		registry.ClientOptDebug(settings.Debug),
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptWriter(os.Stderr),
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+	)
+	if err != nil {
+		return "", fmt.Errorf("creating registry client: %w", err)
+	}
+	installAction.SetRegistryClient(registryClient)
+	return installAction.ChartPathOptions.LocateChart(name, settings)
+}
+
+// loadChart loads the chart at given path, either a directory or a packaged archive
+// (eg: as published by CI, to catch packaging issues such as missing files)
+func loadChart(path string) (*chart.Chart, error) {
+	theChart, err := loader.Load(path)
+	if err != nil {
+		if info, statErr := os.Stat(path); statErr == nil && !info.IsDir() {
+			return nil, fmt.Errorf("invalid chart archive %q: %w", path, err)
+		}
+		return nil, err
+	}
+	return theChart, nil
+}
+
+// cloneChart returns a copy of given chart and its subcharts, that can safely be
+// altered by helm's processing of dependencies (which removes subcharts disabled via
+// conditions or tags, resolves aliases and imports values into parent), without
+// affecting other tests rendering the same chart
+func cloneChart(theChart *chart.Chart) *chart.Chart {
+	clone := *theChart
+	if theChart.Metadata != nil {
+		metadata := *theChart.Metadata
+		metadata.Dependencies = make([]*chart.Dependency, len(theChart.Metadata.Dependencies))
+		for i, dependency := range theChart.Metadata.Dependencies {
+			dependencyCopy := *dependency
+			metadata.Dependencies[i] = &dependencyCopy
+		}
+		clone.Metadata = &metadata
+	}
+	var subcharts []*chart.Chart
+	for _, subchart := range theChart.Dependencies() {
+		subcharts = append(subcharts, cloneChart(subchart))
+	}
+	clone.SetDependencies(subcharts...)
+	return &clone
+}
+
+// filterManifest keeps only the resources whose source matches (or, if include
+// is false, does not match) one of given templates
+func filterManifest(manifest string, templates []string, include bool) string {
+	main, hooks, testHooks := splitSections(manifest)
+	return joinSections(filterResources(main, templates, include), filterResources(hooks, templates, include), filterResources(testHooks, templates, include))
+}
+
+func filterResources(manifest string, templates []string, include bool) string {
+	delimiter := "---\n# Source: "
+	var kept []string
+	for _, chunk := range strings.Split(manifest, delimiter) {
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		sourcePath := strings.TrimSpace(strings.SplitN(chunk, "\n", 2)[0])
+		if matchesTemplates(sourcePath, templates) == include {
+			kept = append(kept, delimiter+strings.TrimRight(chunk, "\n"))
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
+
+// mergeShownManifest replaces, section by section, the resources of given original
+// manifest whose source matches one of given templates with those of given shown
+// manifest, in place of the first original resource of same source, keeping all
+// other resources in their original order and appending new sources at the end
+func mergeShownManifest(original, shown string, templates []string) string {
+	originalMain, originalHooks, originalTestHooks := splitSections(original)
+	shownMain, shownHooks, shownTestHooks := splitSections(shown)
+	return joinSections(
+		mergeShownResources(originalMain, shownMain, templates),
+		mergeShownResources(originalHooks, shownHooks, templates),
+		mergeShownResources(originalTestHooks, shownTestHooks, templates))
+}
+
+func mergeShownResources(original, shown string, templates []string) string {
+	delimiter := "---\n# Source: "
+	var shownSources []string
+	shownChunks := map[string][]string{}
+	for _, chunk := range strings.Split(shown, delimiter) {
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		sourcePath := strings.TrimSpace(strings.SplitN(chunk, "\n", 2)[0])
+		if _, ok := shownChunks[sourcePath]; !ok {
+			shownSources = append(shownSources, sourcePath)
+		}
+		shownChunks[sourcePath] = append(shownChunks[sourcePath], delimiter+strings.TrimRight(chunk, "\n"))
+	}
+	var kept []string
+	for _, chunk := range strings.Split(original, delimiter) {
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		sourcePath := strings.TrimSpace(strings.SplitN(chunk, "\n", 2)[0])
+		if !matchesTemplates(sourcePath, templates) {
+			kept = append(kept, delimiter+strings.TrimRight(chunk, "\n"))
+			continue
+		}
+		// Shown resources of that source take place of first original one only
+		kept = append(kept, shownChunks[sourcePath]...)
+		delete(shownChunks, sourcePath)
+	}
+	for _, sourcePath := range shownSources {
+		kept = append(kept, shownChunks[sourcePath]...)
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
+
+// sortedHooks returns given hooks in a stable order, independent of helm's own
+// ordering, by path, then weight, then kind and name
+func sortedHooks(hooks []*release.Hook) []*release.Hook {
+	sorted := make([]*release.Hook, len(hooks))
+	copy(sorted, hooks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Weight != b.Weight {
+			return a.Weight < b.Weight
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return sorted
+}
+
+// hooksMarker is the line separating regular manifests from hook manifests
+const hooksMarker = "# Hooks"
+
+// testHooksMarker is the line separating hook manifests from test hook manifests
+// (annotated with "helm.sh/hook: test"), which come last
+const testHooksMarker = "# Test hooks"
+
+// hookKeyPrefix sets hook items apart from regular items in comparisons
+const hookKeyPrefix = "[hook] "
+
+// testHookKeyPrefix sets test hook items apart from other items in comparisons
+const testHookKeyPrefix = "[test hook] "
+
+// joinSections combines regular, hook and test hook manifests, adding each hooks
+// section only when it has hooks
+func joinSections(main, hooks, testHooks string) string {
+	manifest := strings.TrimSpace(main) + "\n"
+	if hooks = strings.TrimSpace(hooks); hooks != "" {
+		manifest += hooksMarker + "\n" + hooks + "\n"
+	}
+	if testHooks = strings.TrimSpace(testHooks); testHooks != "" {
+		manifest += testHooksMarker + "\n" + testHooks + "\n"
+	}
+	return manifest
+}
+
+// trimHookSections returns given manifest without its hook sections excluded by
+// options, if any
+func trimHookSections(manifest string, opts RunOptions) string {
+	if opts.NoHooks {
+		main, _, _ := splitSections(manifest)
+		return main
+	}
+	if opts.NoTestHooks {
+		main, hooks, _ := splitSections(manifest)
+		return joinSections(main, hooks, "")
+	}
+	return manifest
+}
+
+// splitSections splits given manifest into its regular, hook and test hook sections
+func splitSections(manifest string) (main, hooks, testHooks string) {
+	manifest, testHooks = cutSection(manifest, testHooksMarker)
+	main, hooks = cutSection(manifest, hooksMarker)
+	return main, hooks, testHooks
+}
+
+// cutSection splits given manifest around the line of given section marker,
+// returning the part before it and the section after it, if any
+func cutSection(manifest, marker string) (before, section string) {
+	if strings.HasPrefix(manifest, marker+"\n") {
+		return "", strings.TrimPrefix(manifest, marker+"\n")
+	}
+	if index := strings.Index(manifest, "\n"+marker+"\n"); index >= 0 {
+		return manifest[:index+1], manifest[index+len(marker)+2:]
+	}
+	return manifest, ""
+}
+
+// splitManifestSections splits all sections of given manifest into items, keying
+// hook and test hook items distinctly
+func splitManifestSections(buffer string, isSourceIgnored bool) map[string]string {
+	main, hooks, testHooks := splitSections(buffer)
+	items := splitManifest(main, isSourceIgnored)
+	for key, content := range splitManifest(hooks, isSourceIgnored) {
+		items[hookKeyPrefix+key] = content
+	}
+	for key, content := range splitManifest(testHooks, isSourceIgnored) {
+		items[testHookKeyPrefix+key] = content
+	}
+	return items
+}
+
+// isTestHook returns whether given hook is a helm test hook, run by "helm test"
+// rather than on install or upgrade
+func isTestHook(hook *release.Hook) bool {
+	for _, event := range hook.Events {
+		if event == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesTemplates returns whether given source path (prefixed with chart name,
+// as rendered by helm) matches one of given template paths or glob patterns
+func matchesTemplates(sourcePath string, templates []string) bool {
+	parts := strings.SplitN(sourcePath, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	for _, template := range templates {
+		template = filepath.ToSlash(template)
+		if parts[1] == template {
+			return true
+		}
+		if ok, _ := filepath.Match(template, parts[1]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkShowOnlyTemplates returns an error if any of given templates does not
+// exist in chart or its subcharts
+func checkShowOnlyTemplates(theChart *chart.Chart, templates []string) error {
+	var templatePaths []string
+	var collect func(c *chart.Chart, prefix string)
+	collect = func(c *chart.Chart, prefix string) {
+		for _, t := range c.Templates {
+			templatePaths = append(templatePaths, prefix+t.Name)
+		}
+		for _, dependency := range c.Dependencies() {
+			collect(dependency, prefix+"charts/"+dependency.Name()+"/")
+		}
+	}
+	collect(theChart, "")
+
+	for _, template := range templates {
+		found := false
+		for _, templatePath := range templatePaths {
+			if matchesTemplates(theChart.Name()+"/"+templatePath, []string{template}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("could not find template %q in chart", template)
+		}
+	}
+	return nil
+}
+
+type resourceHeader struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+// skipCompareAnnotation excludes a resource from comparison, when set to "true",
+// while still validating it
+const skipCompareAnnotation = "testchart.io/skip-compare"
+
+// isSkippedFromComparison returns whether given resource content is annotated to be
+// excluded from comparison
+func isSkippedFromComparison(content string) bool {
+	var header resourceHeader
+	if err := yaml.Unmarshal([]byte(content), &header); err != nil {
+		return false
+	}
+	return header.Metadata.Annotations[skipCompareAnnotation] == "true"
+}
+
+// resourceKind returns the kind of given resource content, or an empty string if it
+// cannot be determined
+func resourceKind(content string) string {
+	var header resourceHeader
+	if err := yaml.Unmarshal([]byte(content), &header); err != nil {
+		return ""
+	}
+	return header.Kind
+}
+
+// resourceIdentity returns the "kind/name" of given resource content, or an empty
+// string if it cannot be determined
+func resourceIdentity(content string) string {
+	var header resourceHeader
+	if err := yaml.Unmarshal([]byte(content), &header); err != nil {
+		return ""
+	}
+	if header.Kind == "" || header.Metadata.Name == "" {
+		return ""
+	}
+	return header.Kind + "/" + header.Metadata.Name
+}
+
+// resourceKey returns the kind, namespace (if any) and name of given resource content,
+// identifying it independently of its source (eg: "Service my-namespace/my-release"),
+// or an empty string if it has no kind or name
+func resourceKey(content string) string {
+	var header resourceHeader
+	if err := yaml.Unmarshal([]byte(content), &header); err != nil {
+		return ""
+	}
+	if header.Kind == "" || header.Metadata.Name == "" {
+		return ""
+	}
+	if header.Metadata.Namespace == "" {
+		return header.Kind + " " + header.Metadata.Name
+	}
+	return header.Kind + " " + header.Metadata.Namespace + "/" + header.Metadata.Name
+}
+
+func loadCueSchema(path, def string, isRequired bool) (*cue.Value, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !isRequired {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	selector, err := cueDefinition(def)
+	if err != nil {
+		return nil, err
+	}
+	schema := cuecontext.New().
+		CompileBytes(data, cue.Filename(path)).
+		LookupPath(cue.MakePath(selector))
+	if !schema.Exists() {
+		return nil, fmt.Errorf("definition %s not found in %q", def, path)
+	}
+
+	if err := schema.Validate(); err != nil {
+		return nil, fmt.Errorf("validating schema: %w", err)
+	}
+
+	Logf(LogLevelDebug, "Loaded cue schema %s from %s", def, path)
+	return &schema, nil
+}
+
+type NopWriterCloser struct {
+	io.Writer
+}
+
+func (NopWriterCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,328 @@
+package testchart
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// TestRunTestsOutputIsDeterministic renders and compares the same chart several
+// times, with differences in multiple resources, and asserts that printed output
+// is byte-identical from one run to the next
+func TestRunTestsOutputIsDeterministic(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	chartDir := copyExample(t, "multi-resource-diff")
+	options := DefaultOutputOptions()
+	options.NoColor = true
+	options.NoDurations = true
+	SetOutputOptions(options)
+	t.Cleanup(func() { SetOutputOptions(DefaultOutputOptions()) })
+
+	opts := DefaultRunOptions()
+	opts.Chart = chartDir
+	opts.TestPath = filepath.Join(chartDir, "tests")
+	opts.NoValidate = true
+
+	var firstOutput string
+	for i := 0; i < 5; i++ {
+		output := captureStdout(t, func() {
+			if _, err := RunTests(nil, opts); err != nil {
+				t.Fatalf("RunTests: %v", err)
+			}
+		})
+		if i == 0 {
+			if !strings.Contains(output, "Different") {
+				t.Fatalf("expected differences to be reported, got:\n%s", output)
+			}
+			firstOutput = output
+			continue
+		}
+		if output != firstOutput {
+			t.Fatalf("output of run %d differs from first run:\n%s\nfirst run:\n%s", i+1, output, firstOutput)
+		}
+	}
+}
+
+// TestMarkdownOutputHonorsASCII runs tests with markdown output and ASCII markers,
+// and asserts that no emoji is printed
+func TestMarkdownOutputHonorsASCII(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	chartDir := copyExample(t, "negative")
+	options := DefaultOutputOptions()
+	options.Format = "markdown"
+	options.ASCII = true
+	SetOutputOptions(options)
+	t.Cleanup(func() { SetOutputOptions(DefaultOutputOptions()) })
+
+	opts := DefaultRunOptions()
+	opts.Chart = chartDir
+	opts.TestPath = filepath.Join(chartDir, "tests")
+	opts.NoValidate = true
+
+	output := captureStdout(t, func() {
+		if _, err := RunTests(nil, opts); err != nil {
+			t.Fatalf("RunTests: %v", err)
+		}
+	})
+	if !strings.Contains(output, asciiMarkers.allPassed) {
+		t.Errorf("expected %q in output, got:\n%s", asciiMarkers.allPassed, output)
+	}
+	for _, r := range output {
+		if r > unicode.MaxASCII {
+			t.Fatalf("expected only ASCII characters in output, got %q in:\n%s", r, output)
+		}
+	}
+}
+
+// TestRun runs tests of an example chart through the library entry point, and
+// asserts that their results are returned without anything printed to stdout, even
+// when coverage is requested
+func TestRun(t *testing.T) {
+	chartDir := copyExample(t, "negative")
+	opts := DefaultRunOptions()
+	opts.Chart = chartDir
+	opts.TestPath = filepath.Join(chartDir, "tests")
+	opts.NoValidate = true
+	opts.Coverage = true
+
+	var results Results
+	output := captureStdout(t, func() {
+		var err error
+		if results, err = Run(opts); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	})
+	if output != "" {
+		t.Errorf("expected nothing printed to stdout, got:\n%s", output)
+	}
+	if !results.IsSuccessful || len(results.Tests) != 2 {
+		t.Fatalf("expected 2 successful tests, got %+v", results)
+	}
+	for _, test := range results.Tests {
+		if !test.IsSuccessful {
+			t.Errorf("expected test %s to pass, got %+v", test.Name, test)
+		}
+	}
+}
+
+// TestRunWithoutTests asserts that Run fails, rather than returning empty results,
+// when tests path is missing or holds no tests
+func TestRunWithoutTests(t *testing.T) {
+	chartDir := writeChart(t, map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: empty\nversion: 1.0.0\n",
+		"tests/.keep": "",
+	})
+	for _, testPath := range []string{"missing", "tests"} {
+		opts := DefaultRunOptions()
+		opts.Chart = chartDir
+		opts.TestPath = filepath.Join(chartDir, testPath)
+		if _, err := Run(opts); !errors.Is(err, errNoTests) {
+			t.Errorf("expected Run with %s tests path to fail with %q, got %v", testPath, errNoTests, err)
+		}
+	}
+}
+
+// TestRunExpectsSchemaError runs a negative test whose values violate the chart's
+// values.schema.json, and asserts that it passes when its error.txt expects that
+// violation, rather than reporting a run error
+func TestRunExpectsSchemaError(t *testing.T) {
+	chartDir := writeChart(t, map[string]string{
+		"Chart.yaml":                        "apiVersion: v2\nname: schema\nversion: 1.0.0\n",
+		"values.yaml":                       "port: 80\n",
+		"values.schema.json":                `{"type": "object", "properties": {"port": {"type": "integer"}}}`,
+		"templates/service.yaml":            "apiVersion: v1\nkind: Service\nmetadata:\n  name: svc\nspec:\n  ports:\n    - port: {{ .Values.port }}\n",
+		"tests/invalid-port/values.yaml":    "port: http\n",
+		"tests/invalid-port/error.txt":      "port: Invalid type. Expected: integer, given: string\n",
+		"tests/mismatched-port/values.yaml": "port: http\n",
+		"tests/mismatched-port/error.txt":   "port is required\n",
+	})
+
+	opts := DefaultRunOptions()
+	opts.Chart = chartDir
+	opts.TestPath = filepath.Join(chartDir, "tests")
+	opts.NoValidate = true
+
+	results, err := Run(opts)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	outcomes := map[string]TestOutcome{}
+	for _, test := range results.Tests {
+		outcomes[test.Name] = test
+	}
+	if outcome := outcomes["invalid-port"]; !outcome.IsSuccessful || outcome.Error != "" {
+		t.Errorf("expected invalid-port to pass, got %+v", outcome)
+	}
+	if outcome := outcomes["mismatched-port"]; outcome.IsSuccessful || outcome.Error != "" || len(outcome.DifferentItems) != 1 {
+		t.Errorf("expected mismatched-port to fail with a different error, got %+v", outcome)
+	}
+}
+
+// TestDryRunUpdateOnlyCountsDifferentTests runs a dry-run update of a test whose
+// rendered manifest matches its expected file, but fails validation, and asserts
+// that it is reported as invalid, rather than as a test that update would fix
+func TestDryRunUpdateOnlyCountsDifferentTests(t *testing.T) {
+	chartDir := writeChart(t, map[string]string{
+		"Chart.yaml":                    "apiVersion: v2\nname: labels\nversion: 1.0.0\n",
+		"templates/configmap.yaml":      "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n",
+		"tests/unlabeled/values.yaml":   "{}\n",
+		"tests/unlabeled/expected.yaml": "---\n# Source: labels/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n",
+	})
+	options := DefaultOutputOptions()
+	options.NoColor = true
+	options.NoDurations = true
+	options.ASCII = true
+	SetOutputOptions(options)
+	t.Cleanup(func() { SetOutputOptions(DefaultOutputOptions()) })
+
+	opts := DefaultRunOptions()
+	opts.Chart = chartDir
+	opts.TestPath = filepath.Join(chartDir, "tests")
+	opts.NoValidate = true
+	opts.RequiredLabels = map[string]string{"app": "<<ANY>>"}
+	opts.IsUpdate = true
+	opts.DryRun = true
+
+	output := captureStdout(t, func() {
+		if _, err := RunTests(nil, opts); err != nil {
+			t.Fatalf("RunTests: %v", err)
+		}
+	})
+	if !strings.Contains(output, asciiMarkers.failed+asciiMarkers.invalid) {
+		t.Errorf("expected test to be reported as invalid, got:\n%s", output)
+	}
+	if want := asciiMarkers.wouldUpdate + " of 0 tests"; !strings.Contains(output, want) {
+		t.Errorf("expected %q in output, got:\n%s", want, output)
+	}
+}
+
+// TestRunRejectsEmptyExpectedError runs a negative test whose error.txt is blank,
+// and asserts that it fails with an explicit error, rather than matching any error
+func TestRunRejectsEmptyExpectedError(t *testing.T) {
+	chartDir := writeChart(t, map[string]string{
+		"Chart.yaml":              "apiVersion: v2\nname: empty\nversion: 1.0.0\n",
+		"templates/fail.yaml":     "{{ fail \"always fails\" }}\n",
+		"tests/blank/values.yaml": "{}\n",
+		"tests/blank/error.txt":   " \n",
+	})
+	opts := DefaultRunOptions()
+	opts.Chart = chartDir
+	opts.TestPath = filepath.Join(chartDir, "tests")
+	opts.NoValidate = true
+
+	results, err := Run(opts)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if test := results.Tests[0]; test.IsSuccessful || !strings.Contains(test.Error, "error.txt file is empty") {
+		t.Errorf("expected test to fail with empty error.txt error, got %+v", test)
+	}
+}
+
+// TestCompareManifestWithoutHooks compares a saved manifest including hooks against
+// expected files with hooks excluded, and asserts that hooks of saved manifest are
+// excluded as well, rather than reported as unexpected
+func TestCompareManifestWithoutHooks(t *testing.T) {
+	configMap := "---\n# Source: hooks/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"
+	job := "---\n# Source: hooks/templates/job.yaml\napiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n"
+	chartDir := writeChart(t, map[string]string{
+		"tests/default/values.yaml":   "{}\n",
+		"tests/default/expected.yaml": configMap + hooksMarker + "\n" + job,
+		"actual.yaml":                 configMap + hooksMarker + "\n" + job,
+	})
+	options := DefaultOutputOptions()
+	options.NoColor = true
+	options.NoDurations = true
+	SetOutputOptions(options)
+	t.Cleanup(func() { SetOutputOptions(DefaultOutputOptions()) })
+
+	opts := DefaultRunOptions()
+	opts.TestPath = filepath.Join(chartDir, "tests")
+	opts.NoHooks = true
+
+	var exitCode int
+	output := captureStdout(t, func() {
+		var err error
+		if exitCode, err = CompareManifest("default", filepath.Join(chartDir, "actual.yaml"), opts); err != nil {
+			t.Fatalf("CompareManifest: %v", err)
+		}
+	})
+	if exitCode != ExitCodeSuccess {
+		t.Errorf("expected comparison to succeed, got exit code %d:\n%s", exitCode, output)
+	}
+}
+
+// writeChart writes given files, by path relative to chart directory, to a
+// temporary chart directory, and returns its path
+func writeChart(t *testing.T, files map[string]string) string {
+	t.Helper()
+	chartDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(chartDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chartDir
+}
+
+// copyExample copies given example chart to a temporary directory, so that files
+// written while running its tests (eg: actual.yaml) do not alter it
+func copyExample(t *testing.T, name string) string {
+	t.Helper()
+	source := filepath.Join("..", "..", "examples", name)
+	target := filepath.Join(t.TempDir(), name)
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(target, relativePath), 0o755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(target, relativePath), data, 0o644)
+	})
+	if err != nil {
+		t.Fatalf("copying example %q: %v", name, err)
+	}
+	return target
+}
+
+// captureStdout returns what given function prints to standard output
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	var buffer bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&buffer, reader)
+		close(done)
+	}()
+	fn()
+	writer.Close()
+	<-done
+	return buffer.String()
+}
@@ -0,0 +1,216 @@
+package testchart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+	cueyaml "cuelang.org/go/encoding/yaml"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// cueSchemaFileName is the default name of the cue file defining the schema that
+// test values are unified with
+const cueSchemaFileName = "values.cue"
+
+// cueSchemaDef is the default name of the cue definition of values schema
+const cueSchemaDef = "#values"
+
+// jsonSchemaFileName is the name of the chart file holding the JSON schema of its
+// values, as loaded by helm along with chart
+const jsonSchemaFileName = "values.schema.json"
+
+// cueIdentifier matches field names that need not be quoted in cue
+var cueIdentifier = regexp.MustCompile(`^[A-Za-z$][A-Za-z0-9_$]*$`)
+
+// cueDefinition returns the selector of given cue definition name, with or without
+// its leading "#"
+func cueDefinition(def string) (cue.Selector, error) {
+	if !strings.HasPrefix(def, "#") {
+		def = "#" + def
+	}
+	if !ast.IsValidIdent(def) {
+		return cue.Selector{}, fmt.Errorf("invalid cue definition name %q", def)
+	}
+	return cue.Def(def), nil
+}
+
+// applySchema unifies given values, loaded from given values file (with environment
+// variables optionally expanded), with given schema, returning resulting values, where
+// regular fields omitted from values are filled with their schema defaults, if any
+// (optional fields, such as `name?: *"foo" | string`, remain absent)
+func applySchema(schema *cue.Value, values map[string]interface{}, valuesPath string, isEnvExpanded bool) (map[string]interface{}, error) {
+	unified, _ := schema.Unify(schema.Context().Encode(values)).Default()
+	if err := unified.Decode(&values); err != nil {
+		// Unify again with values parsed from file, for errors to include their positions
+		if data, readErr := readValuesFile(valuesPath, isEnvExpanded); readErr == nil {
+			if file, parseErr := cueyaml.Extract(valuesPath, data); parseErr == nil {
+				var discarded map[string]interface{}
+				if positionedErr := schema.Unify(schema.Context().BuildFile(file)).Decode(&discarded); positionedErr != nil {
+					err = positionedErr
+				}
+			}
+		}
+		return nil, fmt.Errorf("unifying test values with schema:\n%s", formatCueErrors(err))
+	}
+	return values, nil
+}
+
+// formatCueErrors returns given cue errors formatted one per line, each with its
+// field path and the positions (file:line:col) involved, where available
+func formatCueErrors(err error) string {
+	var lines []string
+	for _, cueErr := range cueerrors.Errors(err) {
+		format, args := cueErr.Msg()
+		line := fmt.Sprintf(format, args...)
+		if path := strings.Join(cueErr.Path(), "."); path != "" {
+			line = path + ": " + line
+		}
+		var positions []string
+		for _, pos := range cueerrors.Positions(cueErr) {
+			if pos.IsValid() {
+				positions = append(positions, pos.String())
+			}
+		}
+		if len(positions) > 0 {
+			line += " (" + strings.Join(positions, ", ") + ")"
+		}
+		lines = append(lines, "- "+line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateJSONSchema validates given test values, coalesced onto chart default values,
+// against the JSON schemas of chart and its subcharts, if any
+func validateJSONSchema(theChart *chart.Chart, testValues map[string]interface{}) error {
+	values, err := chartutil.CoalesceValues(theChart, testValues)
+	if err != nil {
+		return fmt.Errorf("coalescing test values onto chart default values: %w", err)
+	}
+	if err := chartutil.ValidateAgainstSchema(theChart, values); err != nil {
+		return fmt.Errorf("validating values with %s:\n%w", jsonSchemaFileName, err)
+	}
+	return nil
+}
+
+// InitSchema generates a permissive cue schema from the chart's default values, with
+// types inferred from sample values and all fields optional, and checks that it
+// compiles and validates the values of existing tests
+func InitSchema(opts RunOptions, isForced bool) error {
+	if registry.IsOCI(opts.Chart) {
+		return fmt.Errorf("generating schema requires a local chart")
+	}
+	config, err := loadConfig(opts)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	schemaPath, schemaDef, _ := cueSchemaOptions(opts, config)
+	def, err := cueDefinition(schemaDef)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(schemaPath); err == nil && !isForced {
+		return fmt.Errorf("%s file already exists (use --force to overwrite)", schemaPath)
+	}
+
+	chartPath := opts.Chart
+	if chartPath == "" {
+		chartPath = "."
+	}
+	values, err := loadValuesFile(filepath.Join(chartPath, "values.yaml"), false)
+	if err != nil {
+		return fmt.Errorf("loading chart values: %w", err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("// Schema of chart values, generated by testchart from chart's values.yaml\n")
+	fmt.Fprintf(&sb, "%s: ", def)
+	writeCueType(&sb, standardizeTree(values), "")
+	sb.WriteString("\n")
+	schemaText := sb.String()
+
+	// Ensure schema compiles and validates values of existing tests
+	schema := cuecontext.New().CompileString(schemaText, cue.Filename(schemaPath)).LookupPath(cue.MakePath(def))
+	if err := schema.Validate(); err != nil {
+		return fmt.Errorf("validating generated schema: %w", err)
+	}
+	if _, err := os.Stat(opts.TestPath); err == nil {
+		testNames, err := discoverTests(opts.TestPath)
+		if err != nil {
+			return fmt.Errorf("discovering tests: %w", err)
+		}
+		var errs []error
+		for _, testName := range testNames {
+			testValuesPath := valuesFilePath(filepath.Join(opts.TestPath, testName))
+			testValues, err := loadValuesFile(testValuesPath, config.ExpandEnv)
+			if err == nil {
+				_, err = applySchema(&schema, standardizeTree(testValues), testValuesPath, config.ExpandEnv)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("test %s: %w", testName, err))
+			}
+		}
+		if len(errs) > 0 {
+			fmt.Printf("%s, it must be adjusted:\n%v\n", markers.schemaMismatch, errors.Join(errs...))
+		}
+	}
+
+	if err := os.WriteFile(schemaPath, []byte(schemaText), 0o644); err != nil {
+		return fmt.Errorf("writing %s file: %w", schemaPath, err)
+	}
+	fmt.Printf("%s %s\n", markers.generated, schemaPath)
+	return nil
+}
+
+// writeCueType writes the cue type inferred from given sample value
+func writeCueType(sb *strings.Builder, value interface{}, indent string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		sb.WriteString("{\n")
+		for _, key := range keys {
+			name := key
+			if !cueIdentifier.MatchString(name) {
+				name = strconv.Quote(name)
+			}
+			fmt.Fprintf(sb, "%s\t%s?: ", indent, name)
+			writeCueType(sb, v[key], indent+"\t")
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(sb, "%s\t...\n%s}", indent, indent)
+	case []interface{}:
+		sb.WriteString("[...")
+		if len(v) > 0 {
+			writeCueType(sb, v[0], indent)
+		} else {
+			sb.WriteString("_")
+		}
+		sb.WriteString("]")
+	case string:
+		sb.WriteString("string")
+	case bool:
+		sb.WriteString("bool")
+	case int, int64, uint64, float64:
+		sb.WriteString("number")
+	default:
+		sb.WriteString("_")
+	}
+}
@@ -0,0 +1,140 @@
+package testchart
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+)
+
+// decodedDataKey replaces the "data" key of secrets whose values were decoded for
+// display, to make it obvious that they differ from the actual resource
+const decodedDataKey = "data (decoded)"
+
+// decodeSecretData returns given resource content with the base64-encoded values of
+// its "data" field decoded, if it is a Secret. Values that are not valid base64 or
+// do not decode to text are left as is. Content is returned untouched if it is not
+// a Secret or has nothing to decode.
+func decodeSecretData(content string) string {
+	doc, err := unmarshalMapSlice([]byte(content))
+	if err != nil || !isSecret(doc) {
+		return content
+	}
+
+	decoded := false
+	for i, item := range doc {
+		data, ok := item.Value.(mapSlice)
+		if item.Key != "data" || !ok {
+			continue
+		}
+		for j, entry := range data {
+			value, ok := entry.Value.(string)
+			if !ok {
+				continue
+			}
+			bytes, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || !utf8.Valid(bytes) {
+				continue
+			}
+			data[j].Value = string(bytes)
+			decoded = true
+		}
+		doc[i].Key = decodedDataKey
+	}
+	if !decoded {
+		return content
+	}
+
+	bytes, err := marshalYAML(doc)
+	if err != nil {
+		return content
+	}
+	return strings.TrimSpace(string(bytes))
+}
+
+// isSecret returns whether given resource document is of kind Secret
+func isSecret(doc mapSlice) bool {
+	for _, item := range doc {
+		if item.Key == "kind" {
+			return item.Value == "Secret"
+		}
+	}
+	return false
+}
+
+// redactedValue replaces sensitive values in output when redaction is enabled
+const redactedValue = "***"
+
+// sensitiveValueKeys are the lowercase substrings identifying sensitive value keys
+var sensitiveValueKeys = []string{"password", "secret", "token", "apikey", "privatekey", "credential"}
+
+// redactSecret returns given resource content with all values of its "data" and
+// "stringData" fields masked, if it is a Secret
+func redactSecret(content string) string {
+	doc, err := unmarshalMapSlice([]byte(content))
+	if err != nil || !isSecret(doc) {
+		return content
+	}
+
+	for _, item := range doc {
+		if item.Key != "data" && item.Key != "stringData" && item.Key != decodedDataKey {
+			continue
+		}
+		if data, ok := item.Value.(mapSlice); ok {
+			for j := range data {
+				data[j].Value = redactedValue
+			}
+		}
+	}
+
+	bytes, err := marshalYAML(doc)
+	if err != nil {
+		return content
+	}
+	return strings.TrimSpace(string(bytes))
+}
+
+// redactValuesYaml returns given values yaml with the values of all keys that look
+// sensitive (eg: "password" or "apiKey") masked
+func redactValuesYaml(valuesYaml string) (string, error) {
+	values, err := unmarshalMapSlice([]byte(valuesYaml))
+	if err != nil {
+		return "", err
+	}
+	redactValues(values)
+	bytes, err := marshalYAML(values)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bytes)), nil
+}
+
+func redactValues(node interface{}) {
+	switch v := node.(type) {
+	case mapSlice:
+		for i, item := range v {
+			if isSensitiveKey(item.Key) {
+				v[i].Value = redactedValue
+			} else {
+				redactValues(item.Value)
+			}
+		}
+	case []interface{}:
+		for _, elem := range v {
+			redactValues(elem)
+		}
+	}
+}
+
+func isSensitiveKey(key interface{}) bool {
+	name, ok := key.(string)
+	if !ok {
+		return false
+	}
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveValueKeys {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package testchart
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// structuralDifference compares given expected and actual resource contents as
+// parsed YAML trees, where the order of map keys is irrelevant but the order of
+// list elements matters, and returns the path of their first difference (eg:
+// spec.template.spec.initContainers[1].image), if any. Anchors, aliases and merge
+// keys are resolved by parsing. Contents that cannot be parsed are compared as text.
+func structuralDifference(expected, actual string) (string, bool) {
+	expectedTree, expectedErr := unmarshalMapSlice([]byte(expected))
+	actualTree, actualErr := unmarshalMapSlice([]byte(actual))
+	if expectedErr != nil || actualErr != nil {
+		return "", expected != actual
+	}
+	return firstDifference(expectedTree, actualTree, "")
+}
+
+// firstDifference recursively compares given expected and actual nodes, returning
+// the path of their first difference, with map keys visited in sorted order
+func firstDifference(expected, actual interface{}, path string) (string, bool) {
+	switch e := expected.(type) {
+	case mapSlice:
+		a, ok := actual.(mapSlice)
+		if !ok {
+			return rootPath(path), true
+		}
+		expectedValues, actualValues := valuesByKey(e), valuesByKey(a)
+		var names []string
+		for name := range expectedValues {
+			names = append(names, name)
+		}
+		for name := range actualValues {
+			if _, ok := expectedValues[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			keyPath := joinKeyPath(path, name)
+			expectedValue, isExpected := expectedValues[name]
+			actualValue, isActual := actualValues[name]
+			if !isExpected || !isActual {
+				return keyPath, true
+			}
+			if diffPath, isDifferent := firstDifference(expectedValue, actualValue, keyPath); isDifferent {
+				return diffPath, true
+			}
+		}
+		return "", false
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return rootPath(path), true
+		}
+		for i := 0; i < len(e) || i < len(a); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(e) || i >= len(a) {
+				return elemPath, true
+			}
+			if diffPath, isDifferent := firstDifference(e[i], a[i], elemPath); isDifferent {
+				return diffPath, true
+			}
+		}
+		return "", false
+	default:
+		switch actual.(type) {
+		case mapSlice, []interface{}:
+			return rootPath(path), true
+		}
+		if expected != actual {
+			return rootPath(path), true
+		}
+		return "", false
+	}
+}
+
+// valuesByKey returns the values of given ordered map by their stringified key
+func valuesByKey(ms mapSlice) map[string]interface{} {
+	values := make(map[string]interface{}, len(ms))
+	for _, item := range ms {
+		values[fmt.Sprint(item.Key)] = item.Value
+	}
+	return values
+}
+
+// joinKeyPath appends given map key to path, quoting keys that would otherwise be
+// ambiguous (eg: annotations such as helm.sh/hook)
+func joinKeyPath(path, key string) string {
+	if strings.ContainsAny(key, ".[] ") || key == "" {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// rootPath returns given path, or a placeholder for the root of resource
+func rootPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
@@ -0,0 +1,135 @@
+package testchart
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tableColumns are the headers of columns following test names in summary table
+var tableColumns = []string{"STATUS", "DIFF", "MISSING", "EXTRA", "INVALID", "DURATION"}
+
+// tableColumnWidth is the width of all columns of summary table, except test names
+const tableColumnWidth = 9
+
+// TableBuilder prints one aligned row per test, with its status, its counts of
+// different, missing, extra and invalid resources and its duration, for scanning
+// large suites at a glance before drilling into specific failures
+type TableBuilder struct {
+	TestResult
+	recordSettings     recordSettings
+	isUpdate, isDryRun bool
+	longestName        int
+	results            []TestResult
+}
+
+func NewTableBuilder(isUpdate, isDryRun bool) *TableBuilder {
+	return &TableBuilder{isUpdate: isUpdate, isDryRun: isDryRun, recordSettings: defaultRecordSettings()}
+}
+
+func (tb *TableBuilder) StartAllTests(names []string) {
+	tb.results = nil
+	tb.longestName = len("TEST")
+	for _, name := range names {
+		if len(name) > tb.longestName {
+			tb.longestName = len(name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	row := []string{padRight("TEST", tb.longestName)}
+	for _, column := range tableColumns {
+		row = append(row, padRight(column, tableColumnWidth))
+	}
+	fmt.Println(strings.TrimRight(strings.Join(row, " "), " "))
+}
+
+func (tb *TableBuilder) StartTest(name string) {
+	tb.TestResult = newTestResult(name, tb.recordSettings)
+}
+
+func (tb *TableBuilder) EndTest() error {
+	tb.results = append(tb.results, tb.compacted())
+
+	status := tb.status()
+	color := green
+	if !tb.isSuccessful() {
+		color = red
+	}
+	coloredStatus := padRight(status, tableColumnWidth)
+	if !noColor {
+		coloredStatus = color + coloredStatus + reset
+	}
+	row := []string{
+		padRight(tb.name, tb.longestName),
+		coloredStatus,
+		padRight(fmt.Sprint(len(tb.differentItems)), tableColumnWidth),
+		padRight(fmt.Sprint(len(tb.missingItems)), tableColumnWidth),
+		padRight(fmt.Sprint(len(tb.extraItems)), tableColumnWidth),
+		padRight(fmt.Sprint(len(tb.validationErrors)), tableColumnWidth),
+		formatDuration(tb.duration),
+	}
+	fmt.Println(strings.Join(row, " "))
+	return nil
+}
+
+// status returns the status of current test, as a single upper-case word
+func (tb *TableBuilder) status() string {
+	switch {
+	case tb.isTimedOut():
+		return "TIMEOUT"
+	case tb.runError != nil:
+		return "ERROR"
+	case tb.isSuccessful():
+		return "PASS"
+	case tb.isUpdate && !tb.isSame && tb.isDryRun:
+		return "OUTDATED"
+	case tb.isUpdate && !tb.isSame:
+		return "UPDATED"
+	case !tb.isValid:
+		return "INVALID"
+	default:
+		return "FAIL"
+	}
+}
+
+// EndUpdateReview does nothing, as interactive mode is only supported with text output
+func (tb *TableBuilder) EndUpdateReview(isAccepted bool) {
+}
+
+func (tb *TableBuilder) EndAllTests() {
+	failedCount := 0
+	for _, result := range tb.results {
+		if !result.isSuccessful() {
+			failedCount++
+		}
+	}
+	if len(tb.results) == 0 {
+		fmt.Println(markers.noTests)
+	} else if failedCount == 0 {
+		fmt.Printf("%s %d tests passed\n", markers.allPassed, len(tb.results))
+	} else {
+		fmt.Printf("%s %d tests failed out of %d\n", markers.someFailed, failedCount, len(tb.results))
+	}
+}
+
+func (tb *TableBuilder) IsSuccessful() bool {
+	for _, result := range tb.results {
+		if !result.isSuccessful() {
+			return false
+		}
+	}
+	return true
+}
+
+func (tb *TableBuilder) Results() []TestResult {
+	return tb.results
+}
+
+// padRight pads given text with spaces up to given width
+func padRight(text string, width int) string {
+	if len(text) >= width {
+		return text
+	}
+	return text + strings.Repeat(" ", width-len(text))
+}
@@ -0,0 +1,75 @@
+package testchart
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// filterTestsByTags returns the given tests having all given tags in their config
+// file, or all given tests if no tags are given
+func filterTestsByTags(testPath string, testNames, tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return testNames, nil
+	}
+
+	var filtered []string
+	for _, testName := range testNames {
+		testConfig, err := loadTestConfig(filepath.Join(testPath, testName))
+		if err != nil {
+			return nil, fmt.Errorf("loading config of test %s: %w", testName, err)
+		}
+		if hasAllTags(testConfig.Tags, tags) {
+			filtered = append(filtered, testName)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no tests tagged %s", strings.Join(tags, " and "))
+	}
+	return filtered, nil
+}
+
+// hasAllTags returns whether given test tags include all given tags
+func hasAllTags(testTags, tags []string) bool {
+	for _, tag := range tags {
+		if !contains(testTags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListTags prints all distinct tags of discovered tests, in alphabetical order, each
+// with the number of tests having it
+func ListTags(testPath string) error {
+	testNames, err := discoverTests(testPath)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, testName := range testNames {
+		testConfig, err := loadTestConfig(filepath.Join(testPath, testName))
+		if err != nil {
+			return fmt.Errorf("loading config of test %s: %w", testName, err)
+		}
+		for _, tag := range testConfig.Tags {
+			counts[tag]++
+		}
+	}
+	if len(counts) == 0 {
+		fmt.Println("No tagged tests found")
+		return nil
+	}
+
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		fmt.Printf("%s (%d tests)\n", tag, counts[tag])
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package testchart
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// errTestTimeout is reported as the error of tests whose rendering did not complete
+// within configured timeout
+var errTestTimeout = errors.New("rendering timed out")
+
+// renderChart renders given chart with given values, giving up after given timeout
+// (if positive), to prevent a runaway template (eg: a recursive include) from
+// stalling all tests. As helm offers no way to interrupt rendering, a timed out
+// rendering cannot be cancelled: its goroutine is abandoned and keeps running to
+// completion in background, along with given install action and its warning
+// recorder, which must therefore not be reused by subsequent tests. Once stopped,
+// that recorder discards whatever the abandoned rendering logs through the action
+// config. Helm only logs through the standard logger while processing dependencies
+// and coalescing values, before rendering templates, so a rendering timing out in
+// its templates does not log there anymore.
+func renderChart(installAction *action.Install, theChart *chart.Chart, values map[string]interface{}, timeout time.Duration) (*release.Release, error) {
+	if timeout <= 0 {
+		return installAction.Run(theChart, values)
+	}
+
+	type result struct {
+		release *release.Release
+		err     error
+	}
+	results := make(chan result, 1)
+	go func() {
+		theRelease, err := installAction.Run(theChart, values)
+		results <- result{theRelease, err}
+	}()
+
+	select {
+	case result := <-results:
+		return result.release, result.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%w after %s", errTestTimeout, timeout)
+	}
+}
+
+// isTimedOut returns whether test was aborted because its rendering timed out
+func (tr *TestResult) isTimedOut() bool {
+	return errors.Is(tr.runError, errTestTimeout)
+}
@@ -0,0 +1,140 @@
+package testchart
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// valuesFileName and jsonValuesFileName are the names of the values file of a test,
+// either as YAML or as JSON
+const (
+	valuesFileName     = "values.yaml"
+	jsonValuesFileName = "values.json"
+)
+
+// valuesFilePath returns the path of the values file of given test directory, where
+// values.yaml takes precedence over values.json when both exist
+func valuesFilePath(testDir string) string {
+	yamlPath := filepath.Join(testDir, valuesFileName)
+	jsonPath := filepath.Join(testDir, jsonValuesFileName)
+	if !fileExists(yamlPath) && fileExists(jsonPath) {
+		return jsonPath
+	}
+	return yamlPath
+}
+
+// hasValuesFile returns whether given directory has a values file, making it a test
+func hasValuesFile(dir string) bool {
+	return fileExists(filepath.Join(dir, valuesFileName)) || fileExists(filepath.Join(dir, jsonValuesFileName))
+}
+
+// expectedValuesFileName is the name of the optional file, in a test directory,
+// holding a subset of the coalesced values expected for that test
+const expectedValuesFileName = "expected-values.yaml"
+
+// coalesceValues returns test values coalesced onto chart default values, with
+// subchart dependencies processed the same way as when rendering (eg: values
+// imported from subcharts into parent)
+func coalesceValues(theChart *chart.Chart, installAction *action.Install, testValues map[string]interface{}) (chartutil.Values, error) {
+	theChart = cloneChart(theChart)
+	if err := chartutil.ProcessDependencies(theChart, testValues); err != nil {
+		return nil, fmt.Errorf("processing chart dependencies: %w", err)
+	}
+	values, err := chartutil.ToRenderValues(theChart, testValues, chartutil.ReleaseOptions{Name: installAction.ReleaseName, Namespace: installAction.Namespace}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("coalescing test values onto chart default values: %w", err)
+	}
+	return values["Values"].(chartutil.Values), nil
+}
+
+// projectValues returns the subset of given actual values having the same keys as
+// given expected values, preserving the order of expected keys. Keys missing from
+// actual values are omitted.
+func projectValues(expected mapSlice, actual map[string]interface{}) mapSlice {
+	var projected mapSlice
+	for _, item := range expected {
+		key := fmt.Sprint(item.Key)
+		actualValue, ok := actual[key]
+		if !ok {
+			continue
+		}
+		expectedMap, isExpectedMap := item.Value.(mapSlice)
+		actualMap, isActualMap := toStringMap(actualValue)
+		if isExpectedMap && isActualMap {
+			actualValue = projectValues(expectedMap, actualMap)
+		}
+		projected = append(projected, mapItem{Key: item.Key, Value: actualValue})
+	}
+	return projected
+}
+
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case chartutil.Values:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// marshalValues serializes given values to trimmed yaml
+func marshalValues(values interface{}) (string, error) {
+	data, err := marshalYAML(values)
+	if err != nil {
+		return "", fmt.Errorf("serializing values to yaml: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// unmarshalJSONValues decodes given JSON values, with integral numbers decoded as
+// integers rather than floats, the same as when decoding YAML values
+func unmarshalJSONValues(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return jsonNumbersToValues(values).(map[string]interface{}), nil
+}
+
+// jsonNumbersToValues converts the JSON numbers of given tree to integers, or to
+// floats if not integral
+func jsonNumbersToValues(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = jsonNumbersToValues(value)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = jsonNumbersToValues(elem)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
@@ -0,0 +1,99 @@
+package testchart
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// expectedWarningsFileName is the name of the optional file, in a test directory,
+// holding the warnings expected to be logged by helm when rendering that test
+const expectedWarningsFileName = "expected-warnings.txt"
+
+// renderWarningSignature is the signature under which warnings logged by helm while
+// rendering are reported
+const renderWarningSignature = "helm"
+
+// reportRenderWarnings reports given warnings logged by helm while rendering a test
+// not tracking them in an expected file, as validation warnings or, if configured,
+// as validation errors failing the test
+func reportRenderWarnings(builder Builder, warnings []string, opts RunOptions) {
+	addValidationError := builder.AddValidationWarning
+	if opts.WarningsAsErrors {
+		addValidationError = builder.AddValidationError
+	}
+	// Helm may log same warning more than once, as it coalesces values repeatedly
+	reported := map[string]bool{}
+	for _, warning := range warnings {
+		if !reported[warning] {
+			addValidationError(renderWarningSignature, warning)
+			reported[warning] = true
+		}
+	}
+}
+
+// captureMutex serializes captures of the standard logger, which is process-wide,
+// so that concurrent runs do not record each other's warnings
+var captureMutex sync.Mutex
+
+// WarningRecorder captures the warnings logged by helm, both through the action
+// config's log function and the standard logger (used for coalescing values).
+// Warnings are only recorded between Start and Stop, so that those logged later by
+// an abandoned rendering (see renderChart) are discarded.
+type WarningRecorder struct {
+	mutex       sync.Mutex
+	isRecording bool
+	lines       []string
+	savedOutput io.Writer
+	savedFlags  int
+}
+
+// Log records given message, to be passed to action config as log function
+func (wr *WarningRecorder) Log(format string, v ...interface{}) {
+	wr.addLines(fmt.Sprintf(format, v...))
+}
+
+// Write records lines written to the standard logger while capturing
+func (wr *WarningRecorder) Write(p []byte) (int, error) {
+	wr.addLines(string(p))
+	return len(p), nil
+}
+
+func (wr *WarningRecorder) addLines(text string) {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	if !wr.isRecording {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			wr.lines = append(wr.lines, line)
+		}
+	}
+}
+
+// Start clears previously recorded warnings and starts capturing the standard logger
+func (wr *WarningRecorder) Start() {
+	captureMutex.Lock()
+	wr.mutex.Lock()
+	wr.lines = nil
+	wr.isRecording = true
+	wr.mutex.Unlock()
+	wr.savedOutput = log.Writer()
+	wr.savedFlags = log.Flags()
+	log.SetOutput(wr)
+	log.SetFlags(0)
+}
+
+// Stop restores the standard logger and returns the warnings recorded since Start
+func (wr *WarningRecorder) Stop() []string {
+	log.SetOutput(wr.savedOutput)
+	log.SetFlags(wr.savedFlags)
+	captureMutex.Unlock()
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	wr.isRecording = false
+	return wr.lines
+}
@@ -0,0 +1,179 @@
+package testchart
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// watchDebounceDelay is how long to wait for file changes to settle before re-running tests
+const watchDebounceDelay = 300 * time.Millisecond
+
+// clearScreen is the ANSI sequence clearing the terminal and moving cursor home
+const clearScreen = "\033[H\033[2J"
+
+// WatchTests runs given tests (or all tests if none given) and then re-runs them
+// whenever a file of the chart or tests changes, until interrupted. When changes
+// are limited to specific test directories, only those tests are re-run.
+func WatchTests(args []string, opts RunOptions) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	testPath, err := filepath.Abs(opts.TestPath)
+	if err != nil {
+		return fmt.Errorf("getting tests path: %w", err)
+	}
+	watchedPaths := []string{testPath}
+	if !registry.IsOCI(opts.Chart) {
+		chartPath := opts.Chart
+		if chartPath == "" {
+			chartPath = "."
+		}
+		if chartPath, err = filepath.Abs(chartPath); err != nil {
+			return fmt.Errorf("getting chart path: %w", err)
+		}
+		watchedPaths = append(watchedPaths, chartPath)
+	}
+	for _, path := range watchedPaths {
+		if err := addWatchedDirs(watcher, path); err != nil {
+			return fmt.Errorf("watching %q: %w", path, err)
+		}
+	}
+	if opts.ConfigPath != "" {
+		configDir, err := filepath.Abs(filepath.Dir(opts.ConfigPath))
+		if err != nil {
+			return fmt.Errorf("getting config path: %w", err)
+		}
+		if err := watcher.Add(configDir); err != nil {
+			return fmt.Errorf("watching %q: %w", configDir, err)
+		}
+	}
+
+	run := func(names []string) {
+		fmt.Print(clearScreen)
+		if _, err := RunTests(names, opts); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Println(markers.watching + " (press Ctrl+C to stop)...")
+	}
+	run(args)
+
+	changedPaths := map[string]bool{}
+	timer := time.NewTimer(watchDebounceDelay)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if isIgnoredWatchPath(event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					_ = addWatchedDirs(watcher, event.Name)
+				}
+			}
+			changedPaths[event.Name] = true
+			timer.Reset(watchDebounceDelay)
+
+		case <-timer.C:
+			names, ok := affectedTests(changedPaths, testPath, args)
+			changedPaths = map[string]bool{}
+			if ok {
+				run(names)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			Logf(LogLevelError, "Watching files: %v", err)
+		}
+	}
+}
+
+// addWatchedDirs adds given directory and all its sub-directories to watcher
+func addWatchedDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// isIgnoredWatchPath returns whether changes to given path should not trigger a run,
+// typically because testchart itself writes that file
+func isIgnoredWatchPath(path string) bool {
+	name := filepath.Base(path)
+	return name == actualFileName || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")
+}
+
+// affectedTests returns the tests to re-run for given changed paths, along with
+// whether anything needs to run at all. If all changes are within specific test
+// directories, only those tests are returned, otherwise given args are returned
+// to re-run all selected tests.
+func affectedTests(changedPaths map[string]bool, testPath string, args []string) ([]string, bool) {
+	allNames, err := discoverTests(testPath)
+	if err != nil {
+		return args, true
+	}
+
+	testNames := map[string]bool{}
+	for path := range changedPaths {
+		rel, err := filepath.Rel(testPath, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return args, true
+		}
+		rel = filepath.ToSlash(rel)
+
+		// Find innermost test containing changed path
+		testName := ""
+		for _, name := range allNames {
+			if strings.HasPrefix(rel, name+"/") && len(name) > len(testName) {
+				testName = name
+			}
+		}
+		if testName == "" {
+			// Change is outside of any test directory (eg: tests.yaml)
+			return args, true
+		}
+		testNames[testName] = true
+	}
+
+	var names []string
+	for name := range testNames {
+		if len(args) == 0 || matchesTestPatterns(name, args) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, len(names) > 0
+}
+
+func contains(list []string, value string) bool {
+	for _, elem := range list {
+		if elem == value {
+			return true
+		}
+	}
+	return false
+}
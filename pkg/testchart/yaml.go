@@ -0,0 +1,177 @@
+package testchart
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mapSlice is an ordered map, as decoded by unmarshalMapSlice, whose keys are
+// marshaled back in the same order
+type mapSlice []mapItem
+
+type mapItem struct {
+	Key, Value interface{}
+}
+
+// MarshalYAML marshals the items of map in order
+func (ms mapSlice) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, item := range ms {
+		var key, value yaml.Node
+		if err := key.Encode(item.Key); err != nil {
+			return nil, err
+		}
+		if err := value.Encode(item.Value); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &key, &value)
+	}
+	return node, nil
+}
+
+// marshalYAML serializes given value to YAML, with 2-space indentation
+func marshalYAML(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// unmarshalStrict decodes given YAML document into value, failing on unknown fields.
+// An empty document leaves value untouched.
+func unmarshalStrict(data []byte, value interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(value); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// unmarshalMapSlice decodes given YAML document into an ordered map, with anchors,
+// aliases and merge keys (<<) expanded. An empty document decodes to a nil map.
+func unmarshalMapSlice(data []byte) (mapSlice, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	if len(node.Content) == 0 {
+		return nil, nil
+	}
+	value, err := decodeOrdered(node.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := value.(mapSlice)
+	if !ok {
+		return nil, fmt.Errorf("expecting a mapping at line %d", node.Content[0].Line)
+	}
+	return doc, nil
+}
+
+// decodeOrdered decodes given node, with its mappings as ordered maps
+func decodeOrdered(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return decodeOrdered(node.Alias)
+	case yaml.MappingNode:
+		return decodeMapping(node)
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			value, err := decodeOrdered(child)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+}
+
+// decodeMapping decodes given mapping node as an ordered map, where keys brought in
+// by merge keys are placed where the merge key is, unless explicitly set by mapping
+func decodeMapping(node *yaml.Node) (mapSlice, error) {
+	items := mapSlice{}
+	indexes := map[string]int{}
+	set := func(key, value interface{}, isOverride bool) {
+		id := fmt.Sprintf("%T:%v", key, key)
+		if i, ok := indexes[id]; ok {
+			if isOverride {
+				items[i].Value = value
+			}
+			return
+		}
+		indexes[id] = len(items)
+		items = append(items, mapItem{Key: key, Value: value})
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		if keyNode.Kind == yaml.ScalarNode && keyNode.Tag == "!!merge" {
+			merged, err := decodeMergedMappings(valueNode)
+			if err != nil {
+				return nil, err
+			}
+			for _, mapping := range merged {
+				for _, item := range mapping {
+					set(item.Key, item.Value, false)
+				}
+			}
+			continue
+		}
+		key, err := decodeOrdered(keyNode)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeOrdered(valueNode)
+		if err != nil {
+			return nil, err
+		}
+		set(key, value, true)
+	}
+	return items, nil
+}
+
+// decodeMergedMappings decodes the value of a merge key, either a single mapping or
+// a sequence of mappings, in order of precedence
+func decodeMergedMappings(node *yaml.Node) ([]mapSlice, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	nodes := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		nodes = node.Content
+	}
+	var mappings []mapSlice
+	for _, child := range nodes {
+		if child.Kind == yaml.AliasNode {
+			child = child.Alias
+		}
+		if child.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("merge key at line %d must refer to a mapping", child.Line)
+		}
+		mapping, err := decodeMapping(child)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
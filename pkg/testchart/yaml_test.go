@@ -0,0 +1,116 @@
+package testchart
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalMapSliceRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "keeps key order",
+			input:    "zeta: 1\nalpha: 2\nmiddle: 3\n",
+			expected: "zeta: 1\nalpha: 2\nmiddle: 3\n",
+		},
+		{
+			name:     "keeps nested key order",
+			input:    "metadata:\n  name: x\n  labels:\n    b: \"1\"\n    a: \"2\"\n",
+			expected: "metadata:\n  name: x\n  labels:\n    b: \"1\"\n    a: \"2\"\n",
+		},
+		{
+			name:     "indents list items under their parent key",
+			input:    "ports:\n- name: http\n  port: 80\n- name: https\n  port: 443\n",
+			expected: "ports:\n  - name: http\n    port: 80\n  - name: https\n    port: 443\n",
+		},
+		{
+			name:     "expands aliases",
+			input:    "base: &base\n  a: 1\ncopy: *base\n",
+			expected: "base:\n  a: 1\ncopy:\n  a: 1\n",
+		},
+		{
+			name:     "expands merge keys in place, explicit keys taking precedence",
+			input:    "base: &base\n  a: 1\n  b: 2\nchild:\n  x: 0\n  <<: *base\n  b: 3\n",
+			expected: "base:\n  a: 1\n  b: 2\nchild:\n  x: 0\n  a: 1\n  b: 3\n",
+		},
+		{
+			name:     "expands merge key sequences in order of precedence",
+			input:    "one: &one\n  a: 1\ntwo: &two\n  a: 2\n  b: 2\nchild:\n  <<: [*one, *two]\n",
+			expected: "one:\n  a: 1\ntwo:\n  a: 2\n  b: 2\nchild:\n  a: 1\n  b: 2\n",
+		},
+		{
+			name:     "keeps non-string keys and scalar types, quoting ambiguous strings",
+			input:    "80: http\ntrue: yes\nnumber: 1.5\nquoted: \"1.5\"\nempty: null\n",
+			expected: "80: http\ntrue: \"yes\"\nnumber: 1.5\nquoted: \"1.5\"\nempty: null\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := unmarshalMapSlice([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("unmarshalMapSlice: %v", err)
+			}
+			actual, err := marshalYAML(doc)
+			if err != nil {
+				t.Fatalf("marshalYAML: %v", err)
+			}
+			if string(actual) != tt.expected {
+				t.Errorf("expected:\n%s\nactual:\n%s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMapSliceErrors(t *testing.T) {
+	doc, err := unmarshalMapSlice([]byte(""))
+	if err != nil || doc != nil {
+		t.Errorf("expected empty document to decode to nil map, got %v, %v", doc, err)
+	}
+	if _, err := unmarshalMapSlice([]byte("- a\n- b\n")); err == nil {
+		t.Error("expected error for document that is not a mapping")
+	}
+	if _, err := unmarshalMapSlice([]byte("a: &a 1\nb:\n  <<: *a\n")); err == nil {
+		t.Error("expected error for merge key not referring to a mapping")
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	var config struct {
+		Release string `yaml:"release"`
+	}
+	if err := unmarshalStrict([]byte("release: x\n"), &config); err != nil || config.Release != "x" {
+		t.Errorf("expected release to be decoded, got %q, %v", config.Release, err)
+	}
+	if err := unmarshalStrict([]byte(""), &config); err != nil || config.Release != "x" {
+		t.Errorf("expected empty document to leave value untouched, got %q, %v", config.Release, err)
+	}
+	if err := unmarshalStrict([]byte("unknown: x\n"), &config); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestLoadValuesFileStandardizesTree(t *testing.T) {
+	path := filepath.Join(t.TempDir(), valuesFileName)
+	content := "ports:\n  80: http\n  443: https\nflags:\n  true: on\nlist:\n  - nested:\n      1: one\nname: x\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := loadValuesFile(path, false)
+	if err != nil {
+		t.Fatalf("loadValuesFile: %v", err)
+	}
+	expected := map[string]interface{}{
+		"ports": map[string]interface{}{"80": "http", "443": "https"},
+		"flags": map[string]interface{}{"true": "on"},
+		"list":  []interface{}{map[string]interface{}{"nested": map[string]interface{}{"1": "one"}}},
+		"name":  "x",
+	}
+	if actual := standardizeTree(values); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, actual %#v", expected, actual)
+	}
+}
@@ -1,488 +1,321 @@
 package main
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
-	"io"
-	"log"
 	"os"
-	"path/filepath"
-	"regexp"
-	"strings"
-
-	"cuelang.org/go/cue"
-	"cuelang.org/go/cue/cuecontext"
-	cueerrors "cuelang.org/go/cue/errors"
-
-	"helm.sh/helm/v3/pkg/chart"
-	"helm.sh/helm/v3/pkg/chartutil"
-	"helm.sh/helm/v3/pkg/cli"
+	"runtime/debug"
 
 	"github.com/spf13/cobra"
-	"github.com/yannh/kubeconform/pkg/validator"
-	"gopkg.in/yaml.v2"
-	"helm.sh/helm/v3/pkg/action"
-	"helm.sh/helm/v3/pkg/chart/loader"
-)
 
-var (
-	version       = "v0.0.0"
-	saveActual    = false
-	showValues    = false
-	showAllValues = false
-	debugOutput   = ""
+	"github.com/silphid/testchart/pkg/testchart"
 )
 
+var version = "v0.0.0"
+
+// updateFormattingOnlyUsage is the usage of --update-if-formatting-only flag, shared by
+// run and update commands
+const updateFormattingOnlyUsage = "Rewrites expected files whose only differences with rendered manifests are formatting, that is switching to or from split layout, to canonical JSON of jsonKinds or to canonical encoding and source comments, while reporting all other differences as failures (including whitespace changes in YAML)"
+
 func main() {
-	var testPath string
-	var namespace string
-	var release string
-	var chartVersion string
-	var appVersion string
-	isUpdate := false
-	var ignorePatterns []string
+	var opts testchart.RunOptions
+	defaults := testchart.DefaultRunOptions()
+	output := testchart.DefaultOutputOptions()
 
+	isVersion, isVerbose := false, false
+	logLevel := output.LogLevel.String()
 	rootCmd := &cobra.Command{
-		Use:   "testchart",
-		Short: "Tests helm charts",
+		Use:     "testchart",
+		Short:   "Tests helm charts",
+		Version: buildVersion(),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if isVersion {
+				fmt.Println(buildVersion())
+				os.Exit(0)
+			}
+			if os.Getenv("NO_COLOR") != "" || !isTerminal(os.Stdout) {
+				output.NoColor = true
+			}
+			level, err := testchart.ParseLogLevel(logLevel)
+			if err != nil {
+				exitWithError(err)
+			}
+			if isVerbose && level < testchart.LogLevelInfo {
+				level = testchart.LogLevelInfo
+			}
+			output.LogLevel = level
+			testchart.SetOutputOptions(output)
+		},
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&testPath, "path", "p", "tests", "Path to tests directory")
-	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "my-namespace", "Name of namespace to use for rendering chart")
-	rootCmd.PersistentFlags().StringVarP(&release, "release", "r", "my-release", "Name of release to use for rendering chart")
-	rootCmd.PersistentFlags().StringVar(&chartVersion, "chart-version", "", "Version of chart to override for rendering chart")
-	rootCmd.PersistentFlags().StringVar(&appVersion, "app-version", "", "App version of chart to override for rendering chart")
-	rootCmd.PersistentFlags().BoolVarP(&saveActual, "save-actual", "s", false, "Saves an actual.yaml file in each test dir for troubleshooting")
-	rootCmd.PersistentFlags().BoolVarP(&showValues, "show-values", "v", false, "Shows coalesced values for failed tests")
-	rootCmd.PersistentFlags().BoolVarP(&showAllValues, "show-all-values", "V", false, "Shows coalesced values for all tests")
-	rootCmd.PersistentFlags().StringSliceVarP(&ignorePatterns, "ignore", "i", []string{}, "Regex specifying lines to ignore (can be specified multiple times)")
-	rootCmd.PersistentFlags().StringVar(&debugOutput, "debug", "", "location to render failed install output manifests for debugging")
-
+	rootCmd.PersistentFlags().BoolVar(&isVersion, "version", false, "Displays testchart build version and exits")
+	rootCmd.SetVersionTemplate("{{.Version}}\n")
+	rootCmd.PersistentFlags().StringVarP(&opts.TestPath, "path", "p", defaults.TestPath, "Path to tests directory")
+	rootCmd.PersistentFlags().StringVar(&opts.ConfigPath, "config", "", "Path to config file (defaults to tests.yaml in tests directory, if any)")
+	rootCmd.PersistentFlags().StringVarP(&opts.Namespace, "namespace", "n", "", "Name of namespace to use for rendering chart (default \"my-namespace\", unless set in config file)")
+	rootCmd.PersistentFlags().StringVarP(&opts.Release, "release", "r", "", "Name of release to use for rendering chart (default \"my-release\", unless set in config file)")
+	rootCmd.PersistentFlags().StringVarP(&opts.Chart, "chart", "c", "", "Chart to test, either a local directory, a packaged chart archive (.tgz) or an OCI reference (eg: oci://registry/mychart:1.2.3), defaults to current directory")
+	rootCmd.PersistentFlags().BoolVar(&opts.UpdateDependencies, "update-deps", false, "Downloads chart dependencies missing from charts directory (from Chart.lock if any) before running tests, which requires network access")
+	rootCmd.PersistentFlags().IntVar(&opts.Retries, "retries", 0, "Number of times to retry pulling chart, updating dependencies and rendering, with exponential backoff, when failing with transient network errors (never on test failures)")
+	rootCmd.PersistentFlags().StringVar(&opts.ChartVersion, "chart-version", "", "Version of chart to override for rendering chart")
+	rootCmd.PersistentFlags().StringVar(&opts.AppVersion, "app-version", "", "App version of chart to override for rendering chart")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.SetValues, "set", []string{}, "Sets values on top of test values, for ad-hoc runs (eg: image.tag=foo, can be specified multiple times)")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.SetStringValues, "set-string", []string{}, "Sets string values on top of test values, for ad-hoc runs (eg: image.tag=1.0, can be specified multiple times)")
+	rootCmd.PersistentFlags().IntVar(&output.Slowest, "slowest", 0, "Number of slowest tests to list in summary")
+	rootCmd.PersistentFlags().BoolVar(&output.ASCII, "ascii", false, "Uses plain ASCII status markers instead of emoji in output")
+	rootCmd.PersistentFlags().BoolVar(&output.NoColor, "no-color", false, "Disables colors in output (also disabled by NO_COLOR environment variable or when output is not a terminal)")
+	rootCmd.PersistentFlags().BoolVar(&output.GitHub, "github", os.Getenv("GITHUB_ACTIONS") == "true", "Prints failed tests as GitHub Actions annotations, after text output (enabled by default when running in GitHub Actions)")
+	rootCmd.PersistentFlags().BoolVar(&output.SummaryTable, "summary-table", false, "Prints a single aligned row per test, with its status, counts of different, missing, extra and invalid resources and duration, instead of detailed text output")
+	rootCmd.PersistentFlags().BoolVar(&output.NoDurations, "no-durations", false, "Omits durations of tests from output, so that output of same inputs is identical from run to run (eg: for golden testing or stable CI logs)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", logLevel, "Level of diagnostic messages printed to stderr, either error, warn, info or debug")
+	rootCmd.PersistentFlags().BoolVar(&isVerbose, "verbose", false, "Prints informational diagnostic messages to stderr, same as --log-level info")
+	rootCmd.PersistentFlags().BoolVarP(&output.Quiet, "quiet", "q", false, "Only prints failed tests and summary")
+	rootCmd.PersistentFlags().BoolVarP(&output.SaveActual, "save-actual", "s", false, "Saves an actual.yaml file in each test dir for troubleshooting")
+	rootCmd.PersistentFlags().BoolVar(&output.KeepActual, "keep-actual", false, "Saves an actual.yaml file in the dir of each failed or invalid test for troubleshooting, removing that of passed tests")
+	rootCmd.PersistentFlags().BoolVarP(&output.ShowValues, "show-values", "v", false, "Shows coalesced values for failed tests")
+	rootCmd.PersistentFlags().BoolVarP(&output.ShowAllValues, "show-all-values", "V", false, "Shows coalesced values for all tests")
+	rootCmd.PersistentFlags().StringSliceVarP(&opts.IgnorePatterns, "ignore", "i", []string{}, "Regex specifying lines to ignore (can be specified multiple times)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.OnlyPatterns, "only-match", []string{}, "Regex specifying lines to compare, ignoring all others (can be specified multiple times, cannot be combined with --ignore)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.ShowOnly, "show-only", []string{}, "Only render and compare given template (eg: templates/deployment.yaml, can be specified multiple times)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.KubeVersions, "kube-versions", []string{}, "Kubernetes versions to validate manifests against (eg: 1.24,1.29), defaults to latest")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.SchemaLocations, "schema-location", []string{}, "Location of kubernetes JSON schemas for validation, either local or remote (can be specified multiple times, use \"default\" for kubeconform's default location)")
+	rootCmd.PersistentFlags().BoolVar(&opts.FailOnMissingSchemas, "fail-missing-schemas", false, "Reports resources without any JSON schema as invalid")
+	rootCmd.PersistentFlags().BoolVar(&opts.StrictValidation, "strict-validation", defaults.StrictValidation, "Reports unknown fields of resources as invalid (disabling it may hide typos in field names)")
+	rootCmd.PersistentFlags().BoolVar(&opts.NoValidate, "no-validate", false, "Skips validation of rendered manifests")
+	rootCmd.PersistentFlags().BoolVar(&opts.ValidationWarnOnly, "validation-warn-only", false, "Reports invalid resources as warnings, without failing tests")
+	rootCmd.PersistentFlags().BoolVar(&opts.WarningsAsErrors, "warnings-as-errors", false, "Fails tests for which helm logs warnings while rendering (eg: about values that could not be coalesced), unless tracked in their expected-warnings.txt file")
+	rootCmd.PersistentFlags().BoolVar(&opts.NoHooks, "no-hooks", false, "Excludes hook manifests from comparison and actual.yaml output")
+	rootCmd.PersistentFlags().BoolVar(&opts.NoTestHooks, "no-test-hooks", false, "Excludes test hook manifests (annotated with helm.sh/hook: test) from comparison and actual.yaml output, while keeping other hooks")
+	rootCmd.PersistentFlags().StringVar(&opts.SchemaPath, "schema-path", "", "Path to cue file defining schema of values (default \"values.cue\")")
+	rootCmd.PersistentFlags().StringVar(&opts.SchemaDef, "schema-def", "", "Name of cue definition of values schema (default \"#values\")")
+	rootCmd.PersistentFlags().BoolVar(&opts.SortRBACRules, "sort-rbac-rules", false, "Sort rules of Role and ClusterRole resources before comparison")
+	rootCmd.PersistentFlags().BoolVar(&opts.IgnoreSource, "ignore-source", false, "Compares resources by kind, namespace and name regardless of the template they are rendered from, so that moving a resource to another template is not reported as missing and unexpected")
+	rootCmd.PersistentFlags().BoolVar(&opts.Structural, "structural", false, "Compares resources as parsed YAML trees, ignoring the order of map keys but not of list elements, and reports the path of their first difference")
+	rootCmd.PersistentFlags().BoolVar(&opts.MaskVersions, "mask-versions", false, "Normalizes helm.sh/chart and app.kubernetes.io/version labels to the versions of chart before comparison, so that expected files need no update when chart version changes")
+	rootCmd.PersistentFlags().BoolVar(&opts.StripStatus, "strip-status", false, "Removes status, null metadata.creationTimestamp and metadata.generation fields of resources before comparison")
+	rootCmd.PersistentFlags().BoolVar(&opts.DecodeSecrets, "decode-secrets", false, "Shows base64-decoded data in differences of secrets (beware, this exposes secret values)")
+	rootCmd.PersistentFlags().BoolVar(&output.Redact, "redact", false, "Masks secret data and sensitive values in all output")
+	rootCmd.PersistentFlags().StringVarP(&output.Format, "output", "o", "text", "Output format, either text, markdown, diff (plain differences only) or none (only exit code)")
+	rootCmd.PersistentFlags().BoolVar(&opts.Coverage, "coverage", false, "Reports chart templates never rendered by any test")
+	rootCmd.PersistentFlags().DurationVar(&opts.Timeout, "timeout", 0, "Maximum duration of rendering of each test, after which it fails with a timeout error and other tests proceed (eg: 30s), defaults to unlimited")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.Tags, "tag", nil, "Only runs tests having given tag in their test.yaml file (can be specified multiple times, to run tests having all given tags)")
+	rootCmd.PersistentFlags().BoolVar(&opts.Failed, "failed", false, "Only runs tests that failed in last run (ignored if tests are specified explicitly)")
+	rootCmd.PersistentFlags().BoolVar(&opts.FailFast, "fail-fast", false, "Stops running tests after first failure")
+	rootCmd.PersistentFlags().IntVar(&output.DiffContext, "diff-context", testchart.DefaultDiffContext, "Number of unchanged lines to show around changes in differences")
+	rootCmd.PersistentFlags().StringVar(&opts.DiffOut, "diff-out", "", "Writes plain differences of all tests to given file")
+	rootCmd.PersistentFlags().StringVar(&opts.PostRun, "post-run", "", "Shell command to execute after all tests, with results as JSON on its stdin")
+	rootCmd.PersistentFlags().StringVar(&output.DebugOutput, "debug", "", "location to render failed install output manifests for debugging")
+
+	var isListed, isTagsListed bool
 	runCmd := &cobra.Command{
 		Use:   "run [test1 test2 ...]",
 		Short: "Run unit tests",
 		Args:  cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runTests(args, testPath, namespace, release, chartVersion, appVersion, isUpdate, ignorePatterns)
+			if isListed {
+				return testchart.ListTests(args, opts)
+			}
+			if isTagsListed {
+				return testchart.ListTags(opts.TestPath)
+			}
+			return runTestsAndExit(args, opts)
 		},
 	}
+	runCmd.Flags().BoolVar(&opts.UpdateFormattingOnly, "update-if-formatting-only", false, updateFormattingOnlyUsage)
+	runCmd.Flags().BoolVar(&isListed, "list", false, "Lists tests that would be run, with their values and expected files, instead of running them")
+	runCmd.Flags().BoolVar(&isTagsListed, "list-tags", false, "Lists tags of all tests, instead of running them")
 
 	updateCmd := &cobra.Command{
 		Use:   "update [test1 test2 ...]",
 		Short: "Update expected files",
 		Args:  cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			isUpdate = true
-			return runTests(args, testPath, namespace, release, chartVersion, appVersion, isUpdate, ignorePatterns)
+			// Only rewrite formatting, leaving tests with semantic differences failing
+			opts.IsUpdate = !opts.UpdateFormattingOnly
+			return runTestsAndExit(args, opts)
 		},
 	}
+	updateCmd.Flags().BoolVar(&opts.UpdateFormattingOnly, "update-if-formatting-only", false, updateFormattingOnlyUsage)
+	updateCmd.Flags().BoolVar(&opts.Interactive, "interactive", false, "Prompts to accept or skip changes of each test before updating its expected files")
+	updateCmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Reports which expected files would be updated, with their differences, without writing them")
 
-	versionCmd := &cobra.Command{
-		Use:   "version",
-		Short: "Display testchart build version",
-		Args:  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println(version)
+	var isForced, isSeeded, isUpdated bool
+	newCmd := &cobra.Command{
+		Use:   "new name",
+		Short: "Create a new test",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := testchart.NewTest(args[0], opts, isForced, isSeeded); err != nil {
+				return err
+			}
+			if !isUpdated {
+				return nil
+			}
+			opts.IsUpdate = true
+			return runTestsAndExit(args, opts)
 		},
 	}
+	newCmd.Flags().BoolVar(&isForced, "force", false, "Overwrites test directory if it already exists, removing all its files")
+	newCmd.Flags().BoolVar(&isSeeded, "seed-values", false, "Seeds values file of test from chart's default values")
+	newCmd.Flags().BoolVarP(&isUpdated, "update", "u", false, "Updates expected file of test after creating it")
 
-	rootCmd.AddCommand(runCmd)
-	rootCmd.AddCommand(updateCmd)
-	rootCmd.AddCommand(versionCmd)
-
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
+	var isInitForced bool
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create tests directory with a starter config file and a sample test",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return testchart.InitTests(opts, isInitForced)
+		},
 	}
-}
+	initCmd.Flags().BoolVar(&isInitForced, "force", false, "Overwrites config file and sample test if they already exist")
 
-func runTests(args []string, testPath, namespace, releaseName, chartVersion, appVersion string, isUpdate bool, ignorePatterns []string) error {
-	if _, err := os.Stat(testPath); os.IsNotExist(err) {
-		fmt.Println("No tests found")
-		return nil
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Manage cue schema of chart values",
 	}
-
-	schema, err := loadCueSchema()
-	if err != nil {
-		return fmt.Errorf("loading cue schema: %w", err)
+	var isSchemaForced bool
+	schemaInitCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Generate a permissive values.cue schema from chart's default values",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return testchart.InitSchema(opts, isSchemaForced)
+		},
 	}
+	schemaInitCmd.Flags().BoolVar(&isSchemaForced, "force", false, "Overwrites values.cue file if it already exists")
+	schemaCmd.AddCommand(schemaInitCmd)
 
-	var testNames []string
-	if len(args) > 0 {
-		testNames = args
-	} else {
-		files, err := os.ReadDir(testPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, file := range files {
-			if file.IsDir() {
-				testNames = append(testNames, file.Name())
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose chart and tests setup",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !testchart.RunDoctor(opts) {
+				os.Exit(1)
 			}
-		}
-	}
-
-	builder := NewPrintBuilder(isUpdate)
-	builder.StartAllTests(testNames)
-
-	// Create action config
-	settings := cli.New()
-	actionConfig := new(action.Configuration)
-
-	if err := actionConfig.Init(settings.RESTClientGetter(), namespace, "memory", nil); err != nil {
-		log.Fatal(err)
-	}
-
-	// Create install action
-	installAction := action.NewInstall(actionConfig)
-	installAction.Namespace = namespace
-	installAction.ReleaseName = releaseName
-	installAction.DryRun = true
-	installAction.IncludeCRDs = true
-	installAction.ClientOnly = true
-	installAction.Replace = true
-
-	// Load chart
-	chartPath, err := filepath.Abs(".")
-	if err != nil {
-		return fmt.Errorf("getting chart path: %w", err)
-	}
-	theChart, err := loader.Load(chartPath)
-	if err != nil {
-		return fmt.Errorf("loading chart: %w", err)
-	}
-
-	// Optionally override chart and app versions
-	if chartVersion != "" {
-		theChart.Metadata.Version = chartVersion
-	}
-	if appVersion != "" {
-		theChart.Metadata.AppVersion = appVersion
-	}
-
-	for _, testName := range testNames {
-		err := runTest(builder, theChart, installAction, testPath, testName, isUpdate, ignorePatterns, schema)
-		if err != nil {
-			return fmt.Errorf("running test %s: %w", testName, err)
-		}
-	}
-
-	builder.EndAllTests()
-	if !builder.IsSuccessful() {
-		os.Exit(1)
-	}
-	return nil
-}
-
-func runTest(builder Builder, theChart *chart.Chart, installAction *action.Install, testPath, testName string, isUpdate bool, ignorePatterns []string, schema *cue.Value) error {
-	builder.StartTest(testName)
-
-	// Load test values file
-	testValuesPath := filepath.Join(testPath, testName, "values.yaml")
-	testValues, err := loadValuesFile(testValuesPath)
-	if err != nil {
-		return fmt.Errorf("parsing test values file %q: %w", testValuesPath, err)
-	}
-
-	testValues = standardizeTree(testValues)
-
-	if schema != nil {
-		if err := schema.Unify(schema.Context().Encode(testValues)).Decode(&testValues); err != nil {
-			return fmt.Errorf("unifying values.yaml with schema:\n%w\n\n", ManyErr(cueerrors.Errors(err)))
-		}
+			return nil
+		},
 	}
 
-	// Show coalesced values
-	builder.ShowValues(func() (string, error) {
-		values, err := chartutil.ToRenderValues(theChart, testValues, chartutil.ReleaseOptions{Name: installAction.ReleaseName, Namespace: installAction.Namespace}, nil)
-		if err != nil {
-			return "", fmt.Errorf("coalescing test values onto chart default values: %w", err)
-		}
-		values = values["Values"].(chartutil.Values)
-		valuesYaml, err := yaml.Marshal(values)
-		if err != nil {
-			return "", fmt.Errorf("serializing values to yaml: %w", err)
-		}
-		return strings.TrimSpace(string(valuesYaml)), nil
-	})
-
-	// Render chart templates
-	release, err := installAction.Run(theChart, testValues)
-	if debugOutput != "" {
-		file, err := func() (io.WriteCloser, error) {
-			if debugOutput == "-" {
-				return NopWriterCloser{os.Stderr}, nil
+	diffCmd := &cobra.Command{
+		Use:   "diff [test1 test2 ...]",
+		Short: "Print a single unified diff between expected files and rendered manifests of all tests, without writing anything",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Only reviewing change impact, regardless of tests outcome
+			if output.SaveActual || output.KeepActual || opts.DiffOut != "" || (output.DebugOutput != "" && output.DebugOutput != "-") {
+				return fmt.Errorf("diff command does not write anything, so it cannot be combined with --save-actual, --keep-actual, --diff-out or --debug to a file")
 			}
-			return os.Create(debugOutput)
-		}()
-		if err == nil {
-			_, _ = file.Write([]byte(release.Manifest))
-			_ = file.Close()
-		}
-	}
-	if err != nil {
-		return err
-	}
-
-	// Combine regular manifests and hook manifests
-	var manifests bytes.Buffer
-	_, _ = fmt.Fprintln(&manifests, strings.TrimSpace(release.Manifest))
-	for _, m := range release.Hooks {
-		_, _ = fmt.Fprintf(&manifests, "---\n# Source: %s\n%s\n", m.Path, m.Manifest)
-	}
-
-	// Save actual.yaml for troubleshooting purposes
-	if saveActual {
-		actualPath := filepath.Join(testPath, testName, "actual.yaml")
-		err := os.WriteFile(actualPath, manifests.Bytes(), 0o644)
-		if err != nil {
-			return fmt.Errorf("writing actual.yaml file for debug purposes: %w", err)
-		}
-	}
-
-	// Read expected.yaml
-	expectedPath := filepath.Join(testPath, testName, "expected.yaml")
-	expectedBytes, err := os.ReadFile(expectedPath)
-	if err != nil {
-		return fmt.Errorf("reading expected.yaml file: %w", err)
-	}
-	expectedManifest := string(expectedBytes)
-
-	// Filter manifests for ignored patterns
-	ignoreExpressions, err := compileIgnorePatterns(ignorePatterns)
-	if err != nil {
-		return fmt.Errorf("compiling ignore patterns: %w", err)
+			output.Format = "diff"
+			testchart.SetOutputOptions(output)
+			opts.NoValidate = true
+			_, err := testchart.RunTests(args, opts)
+			return err
+		},
 	}
-	actualManifest := removeLinesMatchingPatterns(manifests.String(), ignoreExpressions)
-	expectedManifest = removeLinesMatchingPatterns(expectedManifest, ignoreExpressions)
-
-	// Compare
-	isEqual := compareManifests(builder, expectedManifest, actualManifest)
-	builder.SetTestComparisonResult(isEqual)
 
-	// Update expected?
-	if isUpdate {
-		if !isEqual {
-			err := os.WriteFile(expectedPath, []byte(actualManifest), 0o644)
+	normalizeCmd := &cobra.Command{
+		Use:   "normalize [test1 test2 ...]",
+		Short: "Rewrite expected files in canonical form, without rendering chart",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			count, err := testchart.NormalizeExpectedFiles(opts, args)
 			if err != nil {
-				return fmt.Errorf("writing updated expected.yaml file: %w", err)
+				return err
 			}
-		}
-	}
-
-	// Validate
-	err = validateManifest(builder, release.Manifest)
-	if err != nil {
-		return fmt.Errorf("validating manifest: %w", err)
-	}
-
-	return builder.EndTest()
-}
-
-// standardizeTree converts a tree of interface{} to a tree of map[string]interface{}
-func standardizeTree(node map[string]interface{}) map[string]interface{} {
-	return standardizeNode(node).(map[string]interface{})
-}
-
-func standardizeNode(node interface{}) interface{} {
-	switch v := node.(type) {
-	case map[interface{}]interface{}:
-		newNode := map[string]interface{}{}
-		for key, value := range v {
-			strKey := key.(string)
-			newNode[strKey] = standardizeNode(value)
-		}
-		return newNode
-	case map[string]interface{}:
-		for key, value := range v {
-			v[key] = standardizeNode(value)
-		}
-		return v
-	case []interface{}:
-		for i, elem := range v {
-			v[i] = standardizeNode(elem)
-		}
-		return v
-	default:
-		return v
-	}
-}
-
-func loadValuesFile(filePath string) (map[string]interface{}, error) {
-	yamlFile, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, err
-	}
-
-	var data map[string]interface{}
-	err = yaml.Unmarshal(yamlFile, &data)
-	if err != nil {
-		return nil, err
-	}
-
-	return data, nil
-}
-
-func validateManifest(builder Builder, manifest string) error {
-	v, err := validator.New(nil, validator.Opts{Strict: true, IgnoreMissingSchemas: true})
-	if err != nil {
-		return fmt.Errorf("initializing validator: %w", err)
+			fmt.Printf("Reformatted %d expected files\n", count)
+			return nil
+		},
 	}
 
-	readCloser := io.NopCloser(strings.NewReader(manifest))
-	filePath := "rendered.yaml"
-	for i, res := range v.Validate(filePath, readCloser) { // A file might contain multiple resources
-		// File starts with ---, the parser assumes a first empty resource
-		if res.Status == validator.Invalid || res.Status == validator.Error {
-			sig, err := res.Resource.Signature()
+	var actualPath string
+	compareCmd := &cobra.Command{
+		Use:   "compare test",
+		Short: "Compare a manifest rendered elsewhere against expected files of a test, without rendering chart",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exitCode, err := testchart.CompareManifest(args[0], actualPath, opts)
 			if err != nil {
-				return fmt.Errorf("creating signature for invalid resource #%d: %w", i, err)
+				exitWithError(err)
 			}
-			builder.AddValidationError(sig.QualifiedName(), res.Err.Error())
-		}
-	}
-
-	return nil
-}
-
-func removeLinesMatchingPatterns(input string, ignorePatterns []*regexp.Regexp) string {
-	lines := strings.Split(input, "\n")
-	var filteredLines []string
-	for _, line := range lines {
-		match := false
-		for _, pattern := range ignorePatterns {
-			if pattern.MatchString(line) {
-				match = true
-				break
+			if exitCode != testchart.ExitCodeSuccess {
+				os.Exit(exitCode)
 			}
-		}
-		if !match {
-			filteredLines = append(filteredLines, line)
-		}
-	}
-	return strings.Join(filteredLines, "\n")
-}
-
-func compileIgnorePatterns(ignoreExpressions []string) ([]*regexp.Regexp, error) {
-	var ignorePatterns []*regexp.Regexp
-	for _, expr := range ignoreExpressions {
-		pattern, err := regexp.Compile(expr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to compile ignore pattern %q: %v", expr, err)
-		}
-		ignorePatterns = append(ignorePatterns, pattern)
-	}
-	return ignorePatterns, nil
-}
-
-func compareManifests(builder Builder, expectedManifest, actualManifest string) bool {
-	expected := splitManifest(expectedManifest)
-	actual := splitManifest(actualManifest)
-	areEqual := true
-
-	// Find missing items
-	for source, expectedContent := range expected {
-		if _, ok := actual[source]; !ok {
-			builder.AddMissingItem(source, expectedContent)
-			delete(expected, source)
-			areEqual = false
-		}
+			return nil
+		},
 	}
+	compareCmd.Flags().StringVar(&actualPath, "actual", "-", "Path of rendered manifest to compare (eg: an actual.yaml file saved with --save-actual), or - for stdin")
 
-	// Find extra items
-	for source, actualContent := range actual {
-		if _, ok := expected[source]; !ok {
-			builder.AddExtraItem(source, actualContent)
-			delete(actual, source)
-			areEqual = false
-		}
+	watchCmd := &cobra.Command{
+		Use:   "watch [test1 test2 ...]",
+		Short: "Run unit tests and re-run them whenever files change",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return testchart.WatchTests(args, opts)
+		},
 	}
 
-	// Find different items
-	for source, expectedContent := range expected {
-		if actualContent, ok := actual[source]; ok {
-			if expectedContent != actualContent {
-				builder.AddDifferentItem(source, expectedContent, actualContent)
-				areEqual = false
-			}
-			delete(actual, source)
-		}
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Display testchart build version",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(buildVersion())
+		},
 	}
 
-	return areEqual
-}
-
-func splitManifest(buffer string) map[string]string {
-	items := make(map[string]string)
-	delimiter := "---\n# Source: "
-
-	// Split the buffer into chunks using the delimiter
-	chunks := strings.Split(buffer, delimiter)
-
-	// Process each chunk
-	for _, chunk := range chunks {
-		// Remove leading and trailing whitespaces
-		chunk = strings.TrimSpace(chunk)
-
-		// Skip empty chunks
-		if chunk == "" {
-			continue
-		}
-
-		// Find the source path and content within the chunk
-		parts := strings.SplitN(chunk, "\n", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		// Extract the source path and content
-		sourcePath := strings.TrimSpace(parts[0])
-		content := strings.TrimSpace(parts[1])
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(newCmd)
+	rootCmd.AddCommand(schemaCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(normalizeCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(versionCmd)
 
-		current, ok := items[sourcePath]
-		if ok {
-			content = current + "\n---\n" + content
-		}
-		// Store the content in the map
-		items[sourcePath] = content
+	rootCmd.SilenceErrors = true
+	if err := rootCmd.Execute(); err != nil {
+		exitWithError(err)
 	}
-
-	return items
 }
 
-func loadCueSchema() (*cue.Value, error) {
-	data, err := os.ReadFile("./values.cue")
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil, nil
-		}
-		return nil, err
+// buildVersion returns the version injected at build time via ldflags, or else the
+// module version recorded by go install, if any
+func buildVersion() string {
+	if version != "v0.0.0" {
+		return version
 	}
-
-	schema := cuecontext.New().
-		CompileBytes(data).
-		LookupPath(cue.MakePath(cue.Def("#values")))
-
-	if err := schema.Validate(); err != nil {
-		return nil, fmt.Errorf("validating schema: %w", err)
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
 	}
-
-	return &schema, nil
+	return version
 }
 
-func ManyErr[T error](list []T) error {
-	errs := make([]error, len(list))
-	for i, elem := range list {
-		errs[i] = elem
-	}
-	return errors.Join(errs...)
+// isTerminal returns whether given file is a terminal, as opposed to a regular file or pipe
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-type NopWriterCloser struct {
-	io.Writer
+// exitWithError reports given error and exits with the code of tests that could not
+// be run
+func exitWithError(err error) {
+	testchart.Logf(testchart.LogLevelError, "%v", err)
+	os.Exit(testchart.ExitCodeError)
 }
 
-func (NopWriterCloser) Close() error {
+// runTestsAndExit runs tests and exits with a non-zero code reflecting the most severe
+// class of failure, if any test failed or tests could not be run
+func runTestsAndExit(args []string, opts testchart.RunOptions) error {
+	exitCode, err := testchart.RunTests(args, opts)
+	if err != nil {
+		exitWithError(err)
+	}
+	if exitCode != testchart.ExitCodeSuccess {
+		os.Exit(exitCode)
+	}
 	return nil
 }